@@ -0,0 +1,233 @@
+// Package audit writes an append-only JSON-lines record of every tool call
+// that changes daemon state, optionally hash-chained so that edits and
+// deletions can be detected.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Options configure the audit log.
+type Options struct {
+	File      string
+	MaxSize   int64 // Rotate once the file reaches this many bytes; 0 never rotates
+	MaxFiles  int   // Rotated files kept as File.1 ... File.N
+	HashChain bool  // Chain entries with SHA-256 hashes
+}
+
+// Request is one Engine API request made by a call.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status,omitempty"` // Zero when no response was received
+}
+
+// Entry is one audited tool call.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Session    string    `json:"session,omitempty"`
+	Client     string    `json:"client,omitempty"`      // Authenticated identity
+	AuthMethod string    `json:"auth_method,omitempty"` // "token" or "certificate"
+	Tool       string    `json:"tool"`
+	Arguments  any       `json:"arguments"` // With secrets masked
+	Daemon     string    `json:"daemon"`    // Endpoint name or redacted address
+	Requests   []Request `json:"requests,omitempty"`
+	Status     int       `json:"status,omitempty"` // HTTP status of the last request
+	Outcome    string    `json:"outcome"`          // "success", "error" or "preview"
+	Error      string    `json:"error,omitempty"`
+	ObjectIDs  []string  `json:"object_ids,omitempty"`
+	PrevHash   string    `json:"prev_hash,omitempty"`
+}
+
+// hashSuffixRE matches the hash appended to each line of a chained log.
+var hashSuffixRE = regexp.MustCompile(`,"hash":"([0-9a-f]{64})"}$`)
+
+// Log appends entries to the audit file. A nil *Log discards them.
+type Log struct {
+	opts Options
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	lastHash string
+}
+
+// Open opens or creates the audit file. It returns nil when opts.File is
+// empty. With a hash chain, new entries continue the chain of the file.
+func Open(opts Options) (*Log, error) {
+	if opts.File == "" {
+		return nil, nil
+	}
+	l := &Log{opts: opts}
+	if opts.HashChain {
+		last, err := lastHash(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		l.lastHash = last
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.opts.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+// Write appends e. Errors are returned so callers can report them; the entry
+// is lost in that case.
+func (l *Log) Write(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.opts.HashChain {
+		e.PrevHash = l.lastHash
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var hash string
+	if l.opts.HashChain {
+		sum := sha256.Sum256(line)
+		hash = hex.EncodeToString(sum[:])
+		line = append(line[:len(line)-1], `,"hash":"`+hash+`"}`...)
+	}
+	line = append(line, '\n')
+
+	if l.opts.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if l.opts.HashChain {
+		l.lastHash = hash
+	}
+	return nil
+}
+
+// rotate renames File to File.1, shifting older files up and dropping those
+// beyond MaxFiles. The hash chain continues into the new file.
+func (l *Log) rotate() error {
+	l.f.Close()
+	keep := max(l.opts.MaxFiles, 1)
+	os.Remove(fmt.Sprintf("%s.%d", l.opts.File, keep))
+	for i := keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.opts.File, i), fmt.Sprintf("%s.%d", l.opts.File, i+1))
+	}
+	if err := os.Rename(l.opts.File, l.opts.File+".1"); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return l.open()
+}
+
+// Close closes the audit file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// lastHash returns the hash of the last entry in file, "" when the file is
+// missing or empty.
+func lastHash(file string) (string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer f.Close()
+	var last []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if last == nil {
+		return "", nil
+	}
+	m := hashSuffixRE.FindSubmatch(last)
+	if m == nil {
+		return "", fmt.Errorf("audit log %s does not end with a hashed entry; move it aside to start a new chain", file)
+	}
+	return string(m[1]), nil
+}
+
+// Verify checks the hash chain of the entries read from r, which must be
+// given oldest first (rotated files from the highest number down, then the
+// current file). It returns the number of entries checked, or an error
+// naming the first line that was changed, removed or inserted.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	prev := ""
+	first := true
+	n := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Bytes()
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		m := hashSuffixRE.FindSubmatchIndex(text)
+		if m == nil {
+			return n, fmt.Errorf("line %d: entry has no hash", line)
+		}
+		body := append(append([]byte{}, text[:m[0]]...), '}')
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != string(text[m[2]:m[3]]) {
+			return n, fmt.Errorf("line %d: hash does not match the entry", line)
+		}
+		var e Entry
+		if err := json.Unmarshal(body, &e); err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		// The first entry read may continue a chain from files no longer kept.
+		if !first && e.PrevHash != prev {
+			return n, fmt.Errorf("line %d: chain broken, previous entry missing or changed", line)
+		}
+		first = false
+		prev = string(text[m[2]:m[3]])
+		n++
+	}
+	return n, scanner.Err()
+}
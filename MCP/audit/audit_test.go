@@ -0,0 +1,174 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry(i int) Entry {
+	return Entry{
+		Time:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tool:      "post_containers_create",
+		Daemon:    "prod",
+		Requests:  []Request{{Method: "POST", Path: "/v1.41/containers/create", Status: 201}},
+		Outcome:   "success",
+		ObjectIDs: []string{fmt.Sprintf("container-%d", i)},
+	}
+}
+
+func openLog(t *testing.T, opts Options) *Log {
+	t.Helper()
+	l, err := Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func write(t *testing.T, l *Log, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		if err := l.Write(testEntry(i)); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+}
+
+// readChain returns the lines of the log, oldest first, the way Verify
+// expects them.
+func readChain(t *testing.T, file string, maxFiles int) []string {
+	t.Helper()
+	var lines []string
+	for i := maxFiles; i >= 0; i-- {
+		name := file
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d", file, i)
+		}
+		data, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")...)
+	}
+	return lines
+}
+
+func verify(lines []string) (int, error) {
+	return Verify(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+}
+
+func TestWriteWithoutHashChain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	l := openLog(t, Options{File: file})
+	write(t, l, 0, 2)
+	lines := readChain(t, file, 0)
+	if len(lines) != 2 {
+		t.Fatalf("%d lines, want 2", len(lines))
+	}
+	var e Entry
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ObjectIDs[0] != "container-1" || e.PrevHash != "" || strings.Contains(lines[1], `"hash"`) {
+		t.Errorf("entry %s, want container-1 without hashes", lines[1])
+	}
+
+	var none *Log
+	if err := none.Write(testEntry(0)); err != nil {
+		t.Errorf("nil log: %v", err)
+	}
+	if l, err := Open(Options{}); l != nil || err != nil {
+		t.Errorf("Open without a file = %v, %v; want no log", l, err)
+	}
+}
+
+// The chain continues across rotations and reopening, and Verify accepts
+// the kept files read oldest first.
+func TestRotationKeepsChain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	line, _ := json.Marshal(testEntry(0))
+	opts := Options{File: file, MaxSize: int64(3 * (len(line) + 100)), MaxFiles: 2, HashChain: true}
+	l := openLog(t, opts)
+	write(t, l, 0, 12)
+
+	for _, name := range []string{file, file + ".1", file + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if info.Size() > opts.MaxSize {
+			t.Errorf("%s is %d bytes, over MaxSize %d", name, info.Size(), opts.MaxSize)
+		}
+	}
+	if _, err := os.Stat(file + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 kept beyond MaxFiles: %v", file, err)
+	}
+
+	// Reopening continues the chain from the last entry of the file.
+	l.Close()
+	l = openLog(t, opts)
+	write(t, l, 12, 13)
+
+	lines := readChain(t, file, opts.MaxFiles)
+	if n, err := verify(lines); err != nil || n != len(lines) {
+		t.Errorf("Verify = %d, %v; want %d entries", n, err, len(lines))
+	}
+	var last Entry
+	json.Unmarshal([]byte(lines[len(lines)-1]), &last)
+	if last.ObjectIDs[0] != "container-12" {
+		t.Errorf("last entry %s, want container-12", lines[len(lines)-1])
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	write(t, openLog(t, Options{File: file, HashChain: true}), 0, 4)
+	lines := readChain(t, file, 0)
+	if n, err := verify(lines); err != nil || n != 4 {
+		t.Fatalf("Verify of the untouched log = %d, %v", n, err)
+	}
+
+	edited := append([]string{}, lines...)
+	edited[1] = strings.Replace(edited[1], "container-1", "container-9", 1)
+	removed := append(append([]string{}, lines[:2]...), lines[3:]...)
+	reordered := []string{lines[0], lines[2], lines[1], lines[3]}
+	var unhashed bytes.Buffer
+	json.NewEncoder(&unhashed).Encode(testEntry(9))
+	inserted := append(append(append([]string{}, lines[:2]...), strings.TrimSpace(unhashed.String())), lines[2:]...)
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"edited", edited, "line 2: hash does not match the entry"},
+		{"removed", removed, "line 3: chain broken"},
+		{"reordered", reordered, "line 2: chain broken"},
+		{"inserted", inserted, "line 3: entry has no hash"},
+	}
+	for _, tt := range tests {
+		if _, err := verify(tt.lines); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// A chained log cannot be continued from a file whose last entry has no
+// hash, since the break would look like tampering.
+func TestOpenRefusesUnhashedLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	write(t, openLog(t, Options{File: file}), 0, 1)
+	if _, err := Open(Options{File: file, HashChain: true}); err == nil || !strings.Contains(err.Error(), "does not end with a hashed entry") {
+		t.Errorf("Open of an unhashed log with a hash chain: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/clientauth"
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/docker-engine-api/mcp-server/redact"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxErrorLen bounds the error text kept in an entry.
+const maxErrorLen = 1024
+
+// recorder collects the daemon requests of one audited call.
+type recorder struct {
+	mu       sync.Mutex
+	daemon   string
+	requests []Request
+	preview  bool
+}
+
+type contextKey struct{}
+
+// ObserveDaemonRequest adds a daemon request to the audit entry of the call
+// that made it; it matches config.RequestObserver.
+func ObserveDaemonRequest(endpoint string, req *http.Request, resp *http.Response, err error, _ time.Duration) {
+	rec, ok := req.Context().Value(contextKey{}).(*recorder)
+	if !ok {
+		return
+	}
+	r := Request{Method: req.Method, Path: req.URL.Path}
+	if err == nil {
+		r.Status = resp.StatusCode
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if endpoint != "" {
+		rec.daemon = endpoint
+	}
+	rec.requests = append(rec.requests, r)
+}
+
+// MarkPreview records that the call only previewed a destructive operation
+// and changed nothing.
+func MarkPreview(ctx context.Context) {
+	if rec, ok := ctx.Value(contextKey{}).(*recorder); ok {
+		rec.mu.Lock()
+		rec.preview = true
+		rec.mu.Unlock()
+	}
+}
+
+// audited reports whether calls of the tool change daemon state. Tools that
+// only send GET or HEAD requests are not audited; the POST tools that are
+// allowed in read-only mode, such as post_auth, still are.
+func audited(tool models.Tool) bool {
+	return tool.Method != http.MethodGet && tool.Method != http.MethodHead
+}
+
+// Middleware writes an entry for every call of a state-changing tool.
+func (l *Log) Middleware(tool models.Tool) models.Tool {
+	if l == nil || !audited(tool) {
+		return tool
+	}
+	name := tool.Definition.Name
+	next := tool.Handler
+	tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		rec := &recorder{daemon: "default"}
+		if cfg := config.FromContext(ctx, nil); cfg != nil {
+			rec.daemon = cfg.Name
+			if rec.daemon == "" {
+				rec.daemon = config.RedactHost(cfg.Host)
+			}
+		}
+		args := request.GetArguments()
+		result, err := next(context.WithValue(ctx, contextKey{}, rec), request)
+
+		e := Entry{
+			Time:      time.Now().UTC(),
+			Tool:      name,
+			Arguments: redact.Value(args),
+			Outcome:   "success",
+		}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			e.Session = session.SessionID()
+		}
+		if id, ok := clientauth.FromContext(ctx); ok {
+			e.Client, e.AuthMethod = id.Name, id.Method
+		}
+		rec.mu.Lock()
+		e.Daemon, e.Requests = rec.daemon, rec.requests
+		if rec.preview {
+			e.Outcome = "preview"
+		}
+		rec.mu.Unlock()
+		if len(e.Requests) > 0 {
+			e.Status = e.Requests[len(e.Requests)-1].Status
+		}
+		switch {
+		case err != nil:
+			e.Outcome, e.Error = "error", err.Error()
+		case result != nil && result.IsError:
+			e.Outcome, e.Error = "error", resultText(result)
+		}
+		if len(e.Error) > maxErrorLen {
+			e.Error = e.Error[:maxErrorLen] + "..."
+		}
+		e.ObjectIDs = objectIDs(args, result)
+		if werr := l.Write(e); werr != nil {
+			log.Printf("Audit log: %v", werr)
+		}
+		return result, err
+	}
+	return tool
+}
+
+// objectIDs collects the objects a call addressed or affected: its id and
+// name arguments, the Id of created objects and the lists of pruned ones.
+func objectIDs(args map[string]any, result *mcp.CallToolResult) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(v any) {
+		if s, ok := v.(string); ok && s != "" && !seen[s] {
+			seen[s] = true
+			ids = append(ids, s)
+		}
+	}
+	add(args["id"])
+	add(args["name"])
+	if result == nil || result.IsError {
+		return ids
+	}
+	var body map[string]any
+	if json.Unmarshal([]byte(resultText(result)), &body) != nil {
+		return ids
+	}
+	add(body["Id"])
+	add(body["ID"])
+	for key, val := range body {
+		list, ok := val.([]any)
+		if !ok || !strings.HasSuffix(key, "Deleted") {
+			continue
+		}
+		for _, item := range list {
+			if obj, ok := item.(map[string]any); ok {
+				// ImagesDeleted entries are {"Deleted": id} or {"Untagged": ref}.
+				add(obj["Deleted"])
+				add(obj["Untagged"])
+				continue
+			}
+			add(item)
+		}
+	}
+	return ids
+}
+
+func resultText(result *mcp.CallToolResult) string {
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			return text.Text
+		}
+	}
+	return ""
+}
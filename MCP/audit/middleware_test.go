@@ -0,0 +1,27 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/docker-engine-api/mcp-server/models"
+)
+
+func TestAudited(t *testing.T) {
+	tests := []struct {
+		tool models.Tool
+		want bool
+	}{
+		{models.Tool{Method: "GET", ReadOnly: true}, false},
+		{models.Tool{Method: "HEAD", ReadOnly: true}, false},
+		{models.Tool{Method: "POST"}, true},
+		{models.Tool{Method: "DELETE"}, true},
+		// post_auth and post_containers_id_wait run in read-only mode but
+		// are still POSTs.
+		{models.Tool{Method: "POST", ReadOnly: true}, true},
+	}
+	for _, tt := range tests {
+		if got := audited(tt.tool); got != tt.want {
+			t.Errorf("audited(%s, read-only %t) = %t, want %t", tt.tool.Method, tt.tool.ReadOnly, got, tt.want)
+		}
+	}
+}
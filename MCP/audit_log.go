@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/docker-engine-api/mcp-server/audit"
+	"github.com/docker-engine-api/mcp-server/config"
+)
+
+// loadAuditOptions reads AUDIT_LOG and its rotation and hash chain settings.
+func loadAuditOptions() (audit.Options, error) {
+	opts := audit.Options{
+		File:      config.Setting("AUDIT_LOG"),
+		MaxSize:   100 << 20,
+		MaxFiles:  5,
+		HashChain: config.SettingBool("AUDIT_LOG_HASH_CHAIN"),
+	}
+	if val := config.Setting("AUDIT_LOG_MAX_SIZE"); val != "" {
+		size, err := config.ParseSize(val)
+		if err != nil {
+			return opts, fmt.Errorf("AUDIT_LOG_MAX_SIZE: %w", err)
+		}
+		opts.MaxSize = size
+	}
+	if val := config.Setting("AUDIT_LOG_MAX_FILES"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("AUDIT_LOG_MAX_FILES: invalid count %q", val)
+		}
+		opts.MaxFiles = n
+	}
+	return opts, nil
+}
+
+// verifyAuditFiles checks the hash chain across file and its rotated
+// copies, oldest first.
+func verifyAuditFiles(file string) (int, error) {
+	var readers []io.Reader
+	for i := 1; ; i++ {
+		f, err := os.Open(fmt.Sprintf("%s.%d", file, i))
+		if err != nil {
+			break
+		}
+		defer f.Close()
+		readers = append([]io.Reader{f}, readers...)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	readers = append(readers, f)
+	return audit.Verify(io.MultiReader(readers...))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// requestIDHeader carries the JSON-RPC id of a tool call from the
+// before-call hook to the handler, which mcp-go does not pass it to.
+const requestIDHeader = "X-Mcp-Request-Id"
+
+const cancelledNotification = "notifications/cancelled"
+
+// inflightCalls tracks running tool calls so a notifications/cancelled from
+// the client can abort the daemon request behind them.
+type inflightCalls struct {
+	mu    sync.Mutex
+	calls map[string]context.CancelFunc
+}
+
+func newInflightCalls() *inflightCalls {
+	return &inflightCalls{calls: make(map[string]context.CancelFunc)}
+}
+
+// callKey identifies a request within its session; ids are only unique per client.
+func callKey(ctx context.Context, id mcp.RequestId) string {
+	sessionID := ""
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		sessionID = session.SessionID()
+	}
+	return sessionID + "/" + id.String()
+}
+
+// attach records request ids before each call and cancels calls named by
+// notifications/cancelled. hooks must be the server's hooks.
+func (c *inflightCalls) attach(s *server.MCPServer, hooks *server.Hooks) {
+	hooks.AddBeforeCallTool(func(ctx context.Context, id any, request *mcp.CallToolRequest) {
+		rid, ok := id.(mcp.RequestId)
+		if !ok {
+			rid = mcp.NewRequestId(id)
+		}
+		if request.Header == nil {
+			request.Header = make(map[string][]string)
+		}
+		request.Header.Set(requestIDHeader, callKey(ctx, rid))
+	})
+	s.AddNotificationHandler(cancelledNotification, func(ctx context.Context, n mcp.JSONRPCNotification) {
+		id, ok := n.Params.AdditionalFields["requestId"]
+		if !ok {
+			return
+		}
+		c.cancel(callKey(ctx, mcp.NewRequestId(id)))
+	})
+}
+
+func (c *inflightCalls) cancel(key string) {
+	c.mu.Lock()
+	cancel, ok := c.calls[key]
+	c.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// middleware gives each call its own cancellable context and reports calls
+// that were cancelled as such rather than as a failed daemon request.
+func (c *inflightCalls) middleware(tool models.Tool) models.Tool {
+	next := tool.Handler
+	tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		if key := request.Header.Get(requestIDHeader); key != "" {
+			c.mu.Lock()
+			c.calls[key] = cancel
+			c.mu.Unlock()
+			defer func() {
+				c.mu.Lock()
+				delete(c.calls, key)
+				c.mu.Unlock()
+			}()
+		}
+
+		result, err := next(ctx, request)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return cancelledResult(fmt.Sprintf("Cancelled: %s was cancelled before the daemon finished", tool.Definition.Name)), nil
+		}
+		return result, err
+	}
+	return tool
+}
+
+// cancelledResult reports a call that was cancelled. The structured error
+// lets the outer middleware, which never sees the call's own context end,
+// tell it from a failure.
+func cancelledResult(text string) *mcp.CallToolResult {
+	result := mcp.NewToolResultStructured(map[string]any{"error": "cancelled"}, text)
+	result.IsError = true
+	return result
+}
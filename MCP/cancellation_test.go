@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// cancelTestServer serves tool behind the in-flight call tracking, as main
+// does.
+func cancelTestServer(tool models.Tool) (*server.MCPServer, *inflightCalls) {
+	hooks := &server.Hooks{}
+	srv := server.NewMCPServer("test", "1", server.WithHooks(hooks))
+	calls := newInflightCalls()
+	calls.attach(srv, hooks)
+	tool = calls.middleware(tool)
+	srv.AddTool(tool.Definition, tool.Handler)
+	return srv, calls
+}
+
+// sessionContext returns the context HandleMessage is given for requests of
+// the session id.
+func sessionContext(srv *server.MCPServer, id string) context.Context {
+	return srv.WithContext(context.Background(), server.NewInProcessSession(id, nil))
+}
+
+type toolReply struct {
+	Result struct {
+		IsError           bool           `json:"isError"`
+		StructuredContent map[string]any `json:"structuredContent"`
+		Content           []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"result"`
+}
+
+// callInBackground sends a tools/call with the JSON-RPC id and returns its
+// reply once the handler is running.
+func callInBackground(t *testing.T, srv *server.MCPServer, ctx context.Context, id int, started <-chan struct{}) <-chan toolReply {
+	t.Helper()
+	replies := make(chan toolReply, 1)
+	go func() {
+		msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"get_containers_id_logs","arguments":{}}}`, id)
+		data, _ := json.Marshal(srv.HandleMessage(ctx, []byte(msg)))
+		var reply toolReply
+		json.Unmarshal(data, &reply)
+		replies <- reply
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the call did not start")
+	}
+	return replies
+}
+
+func cancelNotification(id int) []byte {
+	return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":%d,"reason":"user"}}`, id))
+}
+
+func TestCancelledNotification(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	srv, calls := cancelTestServer(blockingTool("get_containers_id_logs", true, started, release))
+	ctx := sessionContext(srv, "session-a")
+
+	replies := callInBackground(t, srv, ctx, 7, started)
+	calls.mu.Lock()
+	_, tracked := calls.calls["session-a/int64:7"]
+	calls.mu.Unlock()
+	if !tracked {
+		t.Fatalf("call not tracked under its session and id: %v", calls.calls)
+	}
+
+	// Ids are only unique per session, and other ids name other calls.
+	srv.HandleMessage(sessionContext(srv, "session-b"), cancelNotification(7))
+	srv.HandleMessage(ctx, cancelNotification(8))
+	select {
+	case reply := <-replies:
+		t.Fatalf("call ended by another cancellation: %+v", reply)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	srv.HandleMessage(ctx, cancelNotification(7))
+	var reply toolReply
+	select {
+	case reply = <-replies:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the cancelled call did not return")
+	}
+	if !reply.Result.IsError || reply.Result.StructuredContent["error"] != "cancelled" {
+		t.Errorf("reply %+v, want a structured cancelled error", reply.Result)
+	}
+	if len(reply.Result.Content) == 0 || reply.Result.Content[0].Text != "Cancelled: get_containers_id_logs was cancelled before the daemon finished" {
+		t.Errorf("reply text %+v", reply.Result.Content)
+	}
+	calls.mu.Lock()
+	defer calls.mu.Unlock()
+	if len(calls.calls) != 0 {
+		t.Errorf("finished calls still tracked: %v", calls.calls)
+	}
+}
+
+// The before-call hook passes the call's key to the middleware in the
+// X-Mcp-Request-Id header; string and number ids both work.
+func TestRequestIDHeader(t *testing.T) {
+	var got []string
+	srv, _ := cancelTestServer(models.Tool{
+		Definition: mcp.NewTool("get_containers_id_logs"),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			got = append(got, request.Header.Get(requestIDHeader))
+			return mcp.NewToolResultText("ok"), nil
+		},
+	})
+	ctx := sessionContext(srv, "session-a")
+	for _, id := range []string{`3`, `"abc"`} {
+		srv.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":`+id+`,"method":"tools/call","params":{"name":"get_containers_id_logs"}}`))
+	}
+	if want := []string{"session-a/int64:3", "session-a/string:abc"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s headers %q, want %q", requestIDHeader, got, want)
+	}
+}
+
+// Calls that fail for another reason keep their own error.
+func TestCancellationMiddlewarePassesResults(t *testing.T) {
+	calls := newInflightCalls()
+	failed := calls.middleware(models.Tool{
+		Definition: mcp.NewTool("get_containers_id_logs"),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultError("API error: no such container"), nil
+		},
+	})
+	result := callWith(t, failed, nil)
+	if !result.IsError || result.StructuredContent != nil || resultText(result) != "API error: no such container" {
+		t.Errorf("result %+v, want the tool's own error", result)
+	}
+}
@@ -0,0 +1,211 @@
+// Package clientauth authenticates the MCP clients calling the server in
+// the network transports, using static tokens or TLS client certificates.
+package clientauth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hashPrefix marks a token hash in the tokens file.
+const hashPrefix = "sha256:"
+
+// reloadInterval bounds how often the tokens file is checked for changes.
+const reloadInterval = 5 * time.Second
+
+// Identity is the authenticated client behind a request.
+type Identity struct {
+	Name   string // Token name from the tokens file, or the certificate's common name
+	Method string // "token" or "certificate"
+}
+
+// contextKey is the context.Context key for the Identity of a request.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries id.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx. ok is false for calls that
+// were not authenticated, such as those over stdio.
+func FromContext(ctx context.Context) (id Identity, ok bool) {
+	id, ok = ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+// HashToken returns the tokens file entry value for a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// Authenticator checks the credentials of incoming requests.
+type Authenticator struct {
+	tokensFile string
+	clientCAs  *x509.CertPool
+
+	mu        sync.Mutex
+	tokens    map[[sha256.Size]byte]string // token hash -> name
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// New returns an authenticator for the given tokens file and client CA
+// bundle; either may be empty. It returns nil when both are empty, meaning
+// clients are not authenticated.
+func New(tokensFile, clientCAFile string) (*Authenticator, error) {
+	if tokensFile == "" && clientCAFile == "" {
+		return nil, nil
+	}
+	a := &Authenticator{tokensFile: tokensFile}
+	if tokensFile != "" {
+		if err := a.loadTokens(); err != nil {
+			return nil, err
+		}
+	}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		a.clientCAs = x509.NewCertPool()
+		if !a.clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client CA file %s contains no PEM certificates", clientCAFile)
+		}
+	}
+	return a, nil
+}
+
+// loadTokens reads the tokens file: one "name sha256:<hex>" entry per line,
+// with blank lines and lines starting with '#' ignored.
+func (a *Authenticator) loadTokens() error {
+	f, err := os.Open(a.tokensFile)
+	if err != nil {
+		return fmt.Errorf("failed to read tokens file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	tokens := make(map[[sha256.Size]byte]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], hashPrefix) {
+			return fmt.Errorf("tokens file %s line %d: expected \"name sha256:<hex>\"", a.tokensFile, line)
+		}
+		raw, err := hex.DecodeString(strings.TrimPrefix(fields[1], hashPrefix))
+		if err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("tokens file %s line %d: invalid sha256 hash", a.tokensFile, line)
+		}
+		tokens[[sha256.Size]byte(raw)] = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	a.mu.Lock()
+	a.tokens = tokens
+	a.modTime = info.ModTime()
+	a.mu.Unlock()
+	return nil
+}
+
+// refreshTokens reloads the tokens file when it has changed, so tokens can
+// be added and revoked without a restart. A broken file keeps the old tokens.
+func (a *Authenticator) refreshTokens() {
+	a.mu.Lock()
+	if time.Since(a.checkedAt) < reloadInterval {
+		a.mu.Unlock()
+		return
+	}
+	a.checkedAt = time.Now()
+	modTime := a.modTime
+	a.mu.Unlock()
+
+	info, err := os.Stat(a.tokensFile)
+	if err != nil || info.ModTime().Equal(modTime) {
+		return
+	}
+	a.loadTokens()
+}
+
+// TLSConfig adds client certificate verification to a server TLS config.
+// Certificates are optional when tokens are accepted as well.
+func (a *Authenticator) TLSConfig(cfg *tls.Config) {
+	if a == nil || a.clientCAs == nil {
+		return
+	}
+	cfg.ClientCAs = a.clientCAs
+	if a.tokensFile != "" {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	} else {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+}
+
+// Authenticate returns the identity behind r, or false when r carries no
+// valid credentials. Tokens are read from "Authorization: Bearer" or X-API-Key.
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, bool) {
+	if a.clientCAs != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		return Identity{Name: cert.Subject.CommonName, Method: "certificate"}, true
+	}
+	if a.tokensFile == "" {
+		return Identity{}, false
+	}
+
+	token := r.Header.Get("X-API-Key")
+	if scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(value)
+	}
+	if token == "" {
+		return Identity{}, false
+	}
+
+	a.refreshTokens()
+	sum := sha256.Sum256([]byte(token))
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for hash, name := range a.tokens {
+		if subtle.ConstantTimeCompare(hash[:], sum[:]) == 1 {
+			return Identity{Name: name, Method: "token"}, true
+		}
+	}
+	return Identity{}, false
+}
+
+// Middleware rejects requests without valid credentials with 401 and passes
+// the identity of the others on in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := a.Authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
@@ -0,0 +1,319 @@
+package clientauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTokens(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func bearer(token string) *http.Request {
+	r := httptest.NewRequest("POST", "/mcp", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	writeTokens(t, path, "# clients\nci "+HashToken("ci-secret")+"\n\nops "+HashToken("ops-secret")+"\n", time.Now())
+	a, err := New(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiKey := httptest.NewRequest("POST", "/mcp", nil)
+	apiKey.Header.Set("X-API-Key", "ops-secret")
+	lower := httptest.NewRequest("POST", "/mcp", nil)
+	lower.Header.Set("Authorization", "bearer ci-secret")
+	basic := httptest.NewRequest("POST", "/mcp", nil)
+	basic.SetBasicAuth("ci", "ci-secret")
+
+	tests := []struct {
+		name string
+		r    *http.Request
+		want string // Identity name, empty when refused
+	}{
+		{"bearer", bearer("ci-secret"), "ci"},
+		{"case-insensitive scheme", lower, "ci"},
+		{"X-API-Key", apiKey, "ops"},
+		{"wrong token", bearer("ci-secret2"), ""},
+		{"the hash itself", bearer(HashToken("ci-secret")), ""},
+		{"basic auth", basic, ""},
+		{"no credentials", httptest.NewRequest("POST", "/mcp", nil), ""},
+	}
+	for _, tt := range tests {
+		id, ok := a.Authenticate(tt.r)
+		if ok != (tt.want != "") || id.Name != tt.want {
+			t.Errorf("%s: %+v, %t; want %q", tt.name, id, ok, tt.want)
+		}
+		if ok && id.Method != "token" {
+			t.Errorf("%s: method %q, want token", tt.name, id.Method)
+		}
+	}
+}
+
+func TestTokensFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"plain":   "ci ci-secret\n",
+		"short":   "ci sha256:abcd\n",
+		"notHex":  "ci sha256:" + strings.Repeat("zz", 32) + "\n",
+		"noToken": "ci\n",
+	} {
+		path := filepath.Join(dir, name)
+		writeTokens(t, path, content, time.Now())
+		if _, err := New(path, ""); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("%s: %v, want an error naming the line", name, err)
+		} else if strings.Contains(err.Error(), "ci-secret") {
+			t.Errorf("%s: the error shows the token: %v", name, err)
+		}
+	}
+	if _, err := New(filepath.Join(dir, "missing"), ""); err == nil {
+		t.Error("a missing tokens file was accepted")
+	}
+	if a, err := New("", ""); a != nil || err != nil {
+		t.Errorf("New without files = %v, %v; want no authenticator", a, err)
+	}
+}
+
+// Editing the tokens file adds and revokes tokens without a restart, and a
+// broken edit keeps the tokens that were loaded.
+func TestTokensFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	start := time.Now().Add(-time.Hour)
+	writeTokens(t, path, "ci "+HashToken("ci-secret")+"\n", start)
+	a, err := New(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(token string, want bool) {
+		t.Helper()
+		a.mu.Lock()
+		a.checkedAt = time.Time{} // Skip the reload interval
+		a.mu.Unlock()
+		if _, ok := a.Authenticate(bearer(token)); ok != want {
+			t.Errorf("token %s accepted %t, want %t", token, ok, want)
+		}
+	}
+	check("ci-secret", true)
+
+	writeTokens(t, path, "ops "+HashToken("ops-secret")+"\n", start.Add(time.Minute))
+	check("ops-secret", true)
+	check("ci-secret", false)
+
+	writeTokens(t, path, "broken\n", start.Add(2*time.Minute))
+	check("ops-secret", true)
+
+	// Within the reload interval the file is not read again.
+	writeTokens(t, path, "ci "+HashToken("ci-secret")+"\n", start.Add(3*time.Minute))
+	a.mu.Lock()
+	a.checkedAt = time.Now()
+	a.mu.Unlock()
+	if _, ok := a.Authenticate(bearer("ci-secret")); ok {
+		t.Error("the tokens file was reloaded within the reload interval")
+	}
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// clientCert issues a client certificate for commonName.
+func (ca *testCA) clientCert(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startServer serves the identity of each request behind a's middleware
+// over TLS.
+func startServer(t *testing.T, a *Authenticator) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := FromContext(r.Context())
+		io.WriteString(w, id.Method+" "+id.Name)
+	})))
+	srv.TLS = &tls.Config{}
+	a.TLSConfig(srv.TLS)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func request(t *testing.T, srv *httptest.Server, cert *tls.Certificate, token string) (int, string) {
+	t.Helper()
+	client := srv.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	if cert != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+	}
+	client = &http.Client{Transport: transport}
+	req, err := http.NewRequest("POST", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(body))
+}
+
+func TestClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tokensFile := filepath.Join(dir, "tokens")
+	writeTokens(t, tokensFile, "ci "+HashToken("ci-secret")+"\n", time.Now())
+	good := ca.clientCert(t, "deploy-bot")
+	other := newTestCA(t).clientCert(t, "intruder")
+
+	// With only a CA, a certificate is required at the handshake.
+	srv := startServer(t, mustNew(t, "", caFile))
+	if code, body := request(t, srv, &good, ""); code != http.StatusOK || body != "certificate deploy-bot" {
+		t.Errorf("certificate only: %d %q", code, body)
+	}
+	if code, _ := request(t, srv, nil, ""); code != 0 {
+		t.Errorf("no certificate: %d, want the handshake refused", code)
+	}
+	if code, _ := request(t, srv, &other, ""); code != 0 {
+		t.Errorf("certificate from another CA: %d, want the handshake refused", code)
+	}
+
+	// With tokens as well, either credential is enough.
+	srv = startServer(t, mustNew(t, tokensFile, caFile))
+	if code, body := request(t, srv, &good, ""); code != http.StatusOK || body != "certificate deploy-bot" {
+		t.Errorf("certificate with tokens: %d %q", code, body)
+	}
+	if code, body := request(t, srv, nil, "ci-secret"); code != http.StatusOK || body != "token ci" {
+		t.Errorf("token with a CA: %d %q", code, body)
+	}
+	if code, _ := request(t, srv, nil, ""); code != http.StatusUnauthorized {
+		t.Errorf("no credentials: %d, want 401", code)
+	}
+
+	if _, err := New("", tokensFile); err == nil || !strings.Contains(err.Error(), "no PEM certificates") {
+		t.Errorf("a CA file without certificates: %v", err)
+	}
+}
+
+func mustNew(t *testing.T, tokensFile, clientCAFile string) *Authenticator {
+	t.Helper()
+	a, err := New(tokensFile, clientCAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	writeTokens(t, path, "ci "+HashToken("ci-secret")+"\n", time.Now())
+	a := mustNew(t, path, "")
+	var seen Identity
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, bearer("wrong"))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Bearer realm="mcp"` {
+		t.Errorf("wrong token: %d, WWW-Authenticate %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+	if seen != (Identity{}) {
+		t.Errorf("a refused request reached the handler as %+v", seen)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, bearer("ci-secret"))
+	if w.Code != http.StatusOK || seen != (Identity{Name: "ci", Method: "token"}) {
+		t.Errorf("valid token: %d, identity %+v", w.Code, seen)
+	}
+
+	// Without an authenticator requests pass unchanged.
+	var none *Authenticator
+	seen = Identity{}
+	w = httptest.NewRecorder()
+	none.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := FromContext(r.Context())
+		if ok {
+			t.Error("an unauthenticated request carries an identity")
+		}
+	})).ServeHTTP(w, httptest.NewRequest("POST", "/mcp", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("nil authenticator: %d", w.Code)
+	}
+}
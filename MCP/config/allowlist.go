@@ -0,0 +1,152 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrDaemonNotAllowed is returned for daemons outside the allowlist, named
+// in API_BASE_URL headers, host arguments or Docker contexts.
+var ErrDaemonNotAllowed = errors.New("daemon address is not allowed")
+
+// DaemonAllowlist limits the daemons clients may choose, by API_BASE_URL
+// header, host argument or Docker context, so the server cannot be used to
+// reach arbitrary hosts.
+type DaemonAllowlist struct {
+	urls      map[string]bool
+	nets      []*net.IPNet
+	endpoints map[string]bool // Named endpoints, allowed by name or address
+}
+
+// LoadDaemonAllowlist reads ALLOWED_DAEMONS: comma separated daemon
+// addresses, CIDRs and endpoint names. It returns nil when the setting is
+// empty, which allows any address.
+func LoadDaemonAllowlist(endpoints Endpoints) (*DaemonAllowlist, error) {
+	return loadDaemonAllowlist(lookupSetting, endpoints)
+}
+
+func loadDaemonAllowlist(lookup lookupFunc, endpoints Endpoints) (*DaemonAllowlist, error) {
+	entries := settingList(lookup, "ALLOWED_DAEMONS")
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	a := &DaemonAllowlist{urls: make(map[string]bool), endpoints: make(map[string]bool)}
+	for _, entry := range entries {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			a.nets = append(a.nets, ipNet)
+			continue
+		}
+		if ep, ok := endpoints.Lookup(entry); ok {
+			a.endpoints[ep.Name] = true
+			a.urls[normalizeAddress(ep.Address)] = true
+			continue
+		}
+		if !strings.Contains(entry, "://") {
+			return nil, fmt.Errorf("ALLOWED_DAEMONS: %q is not a daemon address, CIDR or endpoint name", entry)
+		}
+		if _, _, _, err := parseHost(entry, false); err != nil {
+			return nil, fmt.Errorf("ALLOWED_DAEMONS: %w", err)
+		}
+		a.urls[normalizeAddress(entry)] = true
+	}
+	return a, nil
+}
+
+// AllowsEndpoint reports whether the named endpoint may be chosen by header
+// or host argument.
+func (a *DaemonAllowlist) AllowsEndpoint(name string) bool {
+	return a == nil || a.endpoints[name]
+}
+
+// check returns an error wrapping ErrDaemonNotAllowed unless address is
+// listed exactly or its host lies in one of the allowed networks. Host names
+// are resolved and every address they resolve to must be allowed.
+func (a *DaemonAllowlist) check(address string) error {
+	if a == nil || a.urls[normalizeAddress(address)] {
+		return nil
+	}
+	notAllowed := fmt.Errorf("%w: %s", ErrDaemonNotAllowed, RedactHost(address))
+	if len(a.nets) == 0 {
+		return notAllowed
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Hostname() == "" || u.Scheme == "unix" {
+		return notAllowed
+	}
+	ips := []net.IP{net.ParseIP(u.Hostname())}
+	if ips[0] == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+		if err != nil || len(addrs) == 0 {
+			return notAllowed
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !a.inNets(ip) {
+			return notAllowed
+		}
+	}
+	return nil
+}
+
+// guard checks the daemon address of cfg before it is resolved. Addresses
+// allowed by network only also get their connections checked, tcp and ssh
+// alike, in case the host name resolves elsewhere by the time it is dialed.
+func (a *DaemonAllowlist) guard(cfg *APIConfig) error {
+	address := cfg.Host
+	if address == "" {
+		address = cfg.BaseURL
+	}
+	if err := a.check(address); err != nil {
+		return err
+	}
+	if a != nil && !a.urls[normalizeAddress(address)] {
+		cfg.dialControl = a.dialControl
+	}
+	return nil
+}
+
+func (a *DaemonAllowlist) inNets(ip net.IP) bool {
+	for _, n := range a.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialControl refuses connections to addresses outside the allowed networks.
+// It runs after name resolution, so a host name that later resolves
+// elsewhere cannot be used to get around the allowlist.
+func (a *DaemonAllowlist) dialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil && a.inNets(ip) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrDaemonNotAllowed, address)
+}
+
+// normalizeAddress makes equivalent spellings of an address compare equal.
+func normalizeAddress(address string) string {
+	u, err := url.Parse(strings.TrimSuffix(address, "/"))
+	if err != nil {
+		return address
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
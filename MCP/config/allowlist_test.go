@@ -0,0 +1,158 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testAllowlist(t *testing.T, entries string) *DaemonAllowlist {
+	t.Helper()
+	t.Setenv("ALLOWED_DAEMONS", entries)
+	a, err := LoadDaemonAllowlist(nil)
+	if err != nil {
+		t.Fatalf("LoadDaemonAllowlist: %v", err)
+	}
+	return a
+}
+
+func TestAllowlistCheck(t *testing.T) {
+	a := testAllowlist(t, "tcp://daemon.example:2376,10.1.0.0/16")
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"tcp://daemon.example:2376", true},
+		{"TCP://DAEMON.example:2376/", true},
+		{"tcp://10.1.2.3:2375", true},
+		{"ssh://deploy@10.1.2.3", true},
+		{"tcp://10.2.0.1:2375", false},
+		{"ssh://deploy@127.0.0.1", false},
+		{"unix:///var/run/docker.sock", false},
+		{"tcp://daemon.example:2375", false},
+	}
+	for _, tt := range tests {
+		err := a.check(tt.address)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("check(%q) = %v, want allowed %t", tt.address, err, tt.allowed)
+		}
+		if err != nil && !errors.Is(err, ErrDaemonNotAllowed) {
+			t.Errorf("check(%q) error %v does not wrap ErrDaemonNotAllowed", tt.address, err)
+		}
+	}
+}
+
+func TestAllowlistGuardChecksDialedAddress(t *testing.T) {
+	a := testAllowlist(t, "tcp://listed.example:2375,10.1.0.0/16")
+	listed := &APIConfig{BaseURL: "tcp://listed.example:2375"}
+	if err := a.guard(listed); err != nil || listed.dialControl != nil {
+		t.Errorf("listed address: err %v, dial check %t; want no error and no dial check", err, listed.dialControl != nil)
+	}
+	for _, address := range []string{"tcp://10.1.2.3:2375", "ssh://deploy@10.1.2.3"} {
+		cfg := &APIConfig{BaseURL: address}
+		if err := a.guard(cfg); err != nil || cfg.dialControl == nil {
+			t.Errorf("%s: err %v, dial check %t; want a dial check", address, err, cfg.dialControl != nil)
+		}
+	}
+	var nilList *DaemonAllowlist
+	if err := nilList.guard(&APIConfig{BaseURL: "unix:///var/run/docker.sock"}); err != nil {
+		t.Errorf("nil allowlist refused an address: %v", err)
+	}
+}
+
+// A host name allowed by network can resolve elsewhere when it is dialed;
+// the SSH dial path must refuse it like the tcp one.
+func TestSSHDialRefusesAddressOutsideAllowlist(t *testing.T) {
+	a := testAllowlist(t, "10.1.0.0/16")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan struct{}, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- struct{}{}
+			conn.Close()
+		}
+	}()
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	target := &sshTarget{user: "deploy", addr: l.Addr().String(), socket: defaultRemoteSocket}
+	d := newSSHDialer(target, &SSHConfig{KeyFile: writeTestKey(t), KnownHosts: knownHosts}, time.Second, a.dialControl)
+	_, err = d.DialContext(context.Background(), "tcp", "")
+	if !errors.Is(err, ErrDaemonNotAllowed) {
+		t.Fatalf("DialContext error %v, want ErrDaemonNotAllowed", err)
+	}
+	select {
+	case <-accepted:
+		t.Error("the refused address was connected to")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// writeTestKey writes a new unencrypted ed25519 key and returns its path.
+func writeTestKey(t *testing.T) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadHeaderConfigRefusesAddress(t *testing.T) {
+	a := testAllowlist(t, "10.1.0.0/16")
+	h := http.Header{}
+	h.Set("API_BASE_URL", "tcp://127.0.0.1:2375")
+	if _, err := LoadHeaderConfig(h, a); !errors.Is(err, ErrDaemonNotAllowed) {
+		t.Errorf("LoadHeaderConfig error %v, want ErrDaemonNotAllowed", err)
+	}
+}
+
+func TestLoadDockerContextRefusesAddress(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("DOCKER_HOST", "")
+	meta := filepath.Join(dir, "contexts", "meta", contextDigest("local"))
+	if err := os.MkdirAll(meta, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"Name":"local","Endpoints":{"docker":{"Host":"tcp://127.0.0.1:2375"}}}`
+	if err := os.WriteFile(filepath.Join(meta, "meta.json"), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadDockerContext("local", testAllowlist(t, "10.1.0.0/16")); !errors.Is(err, ErrDaemonNotAllowed) {
+		t.Errorf("context outside the allowlist: error %v, want ErrDaemonNotAllowed", err)
+	}
+	if _, err := LoadDockerContext("default", testAllowlist(t, "10.1.0.0/16")); !errors.Is(err, ErrDaemonNotAllowed) {
+		t.Errorf("default context: error %v, want ErrDaemonNotAllowed", err)
+	}
+	cfg, err := LoadDockerContext("local", nil)
+	if err != nil || !strings.HasPrefix(cfg.BaseURL, "http://127.0.0.1:2375") {
+		t.Errorf("without an allowlist: cfg %v, error %v", cfg, err)
+	}
+}
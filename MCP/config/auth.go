@@ -0,0 +1,122 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Authenticator applies credentials to an outgoing daemon request. The
+// request is already a private copy and may be modified in place.
+type Authenticator interface {
+	Apply(req *http.Request)
+}
+
+// AuthOptions controls where the configured credentials are sent.
+type AuthOptions struct {
+	BearerHeader string // Header for BearerToken; "Authorization" adds the "Bearer " scheme
+	APIKeyHeader string // Header for APIKey
+	APIKeyQuery  string // Query parameter for APIKey; when set it is used instead of APIKeyHeader
+}
+
+// DefaultAuthOptions returns the placement used when nothing is configured.
+func DefaultAuthOptions() AuthOptions {
+	return AuthOptions{
+		BearerHeader: "Authorization",
+		APIKeyHeader: "X-API-Key",
+	}
+}
+
+func loadAuthOptions(lookup lookupFunc) AuthOptions {
+	opts := DefaultAuthOptions()
+	if val, _ := lookup("AUTH_BEARER_HEADER"); val != "" {
+		opts.BearerHeader = val
+	}
+	if val, _ := lookup("API_KEY_HEADER"); val != "" {
+		opts.APIKeyHeader = val
+	}
+	if val, _ := lookup("API_KEY_QUERY_PARAM"); val != "" {
+		opts.APIKeyQuery = val
+	}
+	return opts
+}
+
+// authenticators returns Auth if set, otherwise one authenticator per
+// configured credential.
+func (c *APIConfig) authenticators() []Authenticator {
+	if c.Auth != nil {
+		return c.Auth
+	}
+	opts := c.AuthOptions
+	if opts == (AuthOptions{}) {
+		opts = DefaultAuthOptions()
+	}
+	var auths []Authenticator
+	if c.BearerToken != "" {
+		auths = append(auths, bearerAuth{header: opts.BearerHeader, token: c.BearerToken})
+	}
+	if c.BasicAuth != "" {
+		auths = append(auths, basicAuth(c.BasicAuth))
+	}
+	if c.APIKey != "" {
+		auths = append(auths, apiKeyAuth{header: opts.APIKeyHeader, query: opts.APIKeyQuery, key: c.APIKey})
+	}
+	return auths
+}
+
+type bearerAuth struct {
+	header string
+	token  string
+}
+
+func (a bearerAuth) Apply(req *http.Request) {
+	if strings.EqualFold(a.header, "Authorization") {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+		return
+	}
+	req.Header.Set(a.header, a.token)
+}
+
+// basicAuth is either "user:password" or an already base64-encoded pair.
+type basicAuth string
+
+func (a basicAuth) Apply(req *http.Request) {
+	if user, password, ok := strings.Cut(string(a), ":"); ok {
+		req.SetBasicAuth(user, password)
+		return
+	}
+	req.Header.Set("Authorization", "Basic "+string(a))
+}
+
+type apiKeyAuth struct {
+	header string
+	query  string
+	key    string
+}
+
+func (a apiKeyAuth) Apply(req *http.Request) {
+	if a.query != "" {
+		q := req.URL.Query()
+		q.Set(a.query, a.key)
+		req.URL.RawQuery = q.Encode()
+		return
+	}
+	req.Header.Set(a.header, a.key)
+}
+
+// authTransport applies credentials to a copy of each request, so the
+// request the caller holds (and reports in errors) never contains them.
+type authTransport struct {
+	next  http.RoundTripper
+	auths []Authenticator
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.auths) == 0 {
+		return t.next.RoundTrip(req)
+	}
+	authed := req.Clone(req.Context())
+	for _, a := range t.auths {
+		a.Apply(authed)
+	}
+	return t.next.RoundTrip(authed)
+}
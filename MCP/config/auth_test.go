@@ -0,0 +1,160 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// A redirect from the daemon must not carry the credentials to the host it
+// names.
+func TestRedirectsAreNotFollowed(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "1.30")
+	var leaked atomic.Int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked.Add(1)
+	}))
+	defer other.Close()
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" || r.Header.Get("X-API-Key") != "k3y" {
+			t.Errorf("daemon request without credentials: %v", r.Header)
+		}
+		http.Redirect(w, r, other.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer daemon.Close()
+
+	cfg := &APIConfig{BaseURL: daemon.URL, BearerToken: "s3cret", APIKey: "k3y"}
+	if err := cfg.Resolve(); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	resp, err := cfg.HTTPClient().Get(cfg.BaseURL + "/containers/json")
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, errRedirect) {
+		t.Errorf("GET error %v, want errRedirect", err)
+	}
+	if n := leaked.Load(); n != 0 {
+		t.Errorf("redirect followed %d times", n)
+	}
+}
+
+func TestCredentialPlacement(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "1.41")
+	tests := []struct {
+		name   string
+		cfg    APIConfig
+		header map[string]string
+		query  map[string]string
+	}{
+		{
+			name:   "bearer",
+			cfg:    APIConfig{BearerToken: "t0k3n"},
+			header: map[string]string{"Authorization": "Bearer t0k3n"},
+		},
+		{
+			name:   "bearer in a custom header",
+			cfg:    APIConfig{BearerToken: "t0k3n", AuthOptions: AuthOptions{BearerHeader: "X-Auth-Token"}},
+			header: map[string]string{"X-Auth-Token": "t0k3n", "Authorization": ""},
+		},
+		{
+			name:   "basic pair",
+			cfg:    APIConfig{BasicAuth: "ci:hunter2"},
+			header: map[string]string{"Authorization": "Basic Y2k6aHVudGVyMg=="},
+		},
+		{
+			name:   "basic encoded",
+			cfg:    APIConfig{BasicAuth: "Y2k6aHVudGVyMg=="},
+			header: map[string]string{"Authorization": "Basic Y2k6aHVudGVyMg=="},
+		},
+		{
+			name:   "api key",
+			cfg:    APIConfig{APIKey: "k3y"},
+			header: map[string]string{"X-API-Key": "k3y"},
+		},
+		{
+			name:   "api key in a custom header",
+			cfg:    APIConfig{APIKey: "k3y", AuthOptions: AuthOptions{APIKeyHeader: "X-Token"}},
+			header: map[string]string{"X-Token": "k3y", "X-API-Key": ""},
+		},
+		{
+			name:   "api key in the query",
+			cfg:    APIConfig{APIKey: "k3y", AuthOptions: AuthOptions{APIKeyHeader: "X-API-Key", APIKeyQuery: "api_key"}},
+			header: map[string]string{"X-API-Key": ""},
+			query:  map[string]string{"api_key": "k3y", "all": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+			}))
+			defer daemon.Close()
+			cfg := tt.cfg
+			cfg.BaseURL = daemon.URL
+			if err := cfg.Resolve(); err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if _, err := get(t, &cfg, "/containers/json?all=1"); err != nil {
+				t.Fatalf("GET: %v", err)
+			}
+			for name, want := range tt.header {
+				if v := got.Header.Get(name); v != want {
+					t.Errorf("header %s = %q, want %q", name, v, want)
+				}
+			}
+			for name, want := range tt.query {
+				if v := got.URL.Query().Get(name); v != want {
+					t.Errorf("query %s = %q, want %q", name, v, want)
+				}
+			}
+			if tt.query == nil && got.URL.RawQuery != "all=1" {
+				t.Errorf("query %q, want it unchanged", got.URL.RawQuery)
+			}
+		})
+	}
+}
+
+// Errors name the request the caller made, which never holds the
+// credentials, even when the API key travels in the query.
+func TestCredentialsNotInErrors(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "1.41")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://elsewhere.invalid/", http.StatusFound)
+	}))
+	defer redirecting.Close()
+
+	secrets := []string{"s3cret", "k3y", "hunter2", "Y2k6aHVudGVyMg"}
+	for _, baseURL := range []string{"http://" + addr, redirecting.URL} {
+		cfg := &APIConfig{
+			BaseURL:     baseURL,
+			BearerToken: "s3cret",
+			APIKey:      "k3y",
+			BasicAuth:   "ci:hunter2",
+			AuthOptions: AuthOptions{BearerHeader: "X-Auth-Token", APIKeyQuery: "api_key"},
+		}
+		if err := cfg.Resolve(); err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+		_, err := get(t, cfg, "/containers/json")
+		if err == nil {
+			t.Fatalf("GET %s succeeded", baseURL)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(err.Error(), secret) {
+				t.Errorf("error %q contains %q", err, secret)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientOptions tunes the HTTP client shared by all tools for one daemon.
+type ClientOptions struct {
+	DialTimeout           time.Duration // Connecting to the daemon, including the SSH handshake
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration // Zero waits as long as the call deadline allows
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+
+	DefaultTimeout time.Duration // Deadline for a tool call without timeout_seconds
+	LongTimeout    time.Duration // Deadline for long-running tools such as pulls, pushes and streams
+
+	ProxyURL string // Proxy for tcp:// and http(s):// daemons; HTTP(S)_PROXY is used when empty
+	CABundle string // Extra PEM roots trusted for https:// daemons and proxies
+}
+
+// DefaultClientOptions returns the options used when nothing is configured.
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		DialTimeout:         10 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConnsPerHost: 10,
+		DefaultTimeout:      30 * time.Second,
+		LongTimeout:         30 * time.Minute,
+	}
+}
+
+// loadClientOptions overlays the HTTP_* and TOOL_* settings on the defaults.
+// Durations accept Go syntax ("90s", "5m") or a plain number of seconds.
+func loadClientOptions(lookup lookupFunc) (ClientOptions, error) {
+	opts := DefaultClientOptions()
+	durations := []struct {
+		key string
+		dst *time.Duration
+	}{
+		{"HTTP_DIAL_TIMEOUT", &opts.DialTimeout},
+		{"HTTP_TLS_HANDSHAKE_TIMEOUT", &opts.TLSHandshakeTimeout},
+		{"HTTP_RESPONSE_HEADER_TIMEOUT", &opts.ResponseHeaderTimeout},
+		{"HTTP_IDLE_CONN_TIMEOUT", &opts.IdleConnTimeout},
+		{"TOOL_TIMEOUT", &opts.DefaultTimeout},
+		{"TOOL_LONG_TIMEOUT", &opts.LongTimeout},
+	}
+	for _, d := range durations {
+		val, ok := lookup(d.key)
+		if !ok || val == "" {
+			continue
+		}
+		parsed, err := ParseDuration(val)
+		if err != nil {
+			return opts, fmt.Errorf("%s: %w", d.key, err)
+		}
+		*d.dst = parsed
+	}
+	if val, ok := lookup("HTTP_MAX_IDLE_CONNS_PER_HOST"); ok && val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("HTTP_MAX_IDLE_CONNS_PER_HOST: invalid count %q", val)
+		}
+		opts.MaxIdleConnsPerHost = n
+	}
+	if val, ok := lookup("HTTP_PROXY_URL"); ok && val != "" {
+		if _, err := url.Parse(val); err != nil {
+			return opts, fmt.Errorf("HTTP_PROXY_URL: %w", err)
+		}
+		opts.ProxyURL = val
+	}
+	if val, ok := lookup("CA_BUNDLE"); ok && val != "" {
+		if _, err := os.Stat(val); err != nil {
+			return opts, fmt.Errorf("CA_BUNDLE: %w", err)
+		}
+		opts.CABundle = val
+	}
+	return opts, nil
+}
+
+// LoadClientOptions returns the client options from the environment and the
+// configuration file.
+func LoadClientOptions() (ClientOptions, error) {
+	return loadClientOptions(lookupSetting)
+}
+
+// ParseDuration accepts Go duration syntax or a plain number of seconds.
+func ParseDuration(val string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(val, 64); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("negative duration %q", val)
+		}
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", val)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", val)
+	}
+	return d, nil
+}
+
+// ParseSize accepts a number of bytes with an optional K, M or G suffix
+// (powers of 1024), such as "500K" or "100MB".
+func ParseSize(val string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(val)), "B")
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", val)
+	}
+	return n * multiplier, nil
+}
+
+// CallTimeout returns the default deadline for a tool call.
+func (o ClientOptions) CallTimeout(longRunning bool) time.Duration {
+	if longRunning {
+		return o.LongTimeout
+	}
+	return o.DefaultTimeout
+}
+
+// newTransport returns the pooled base transport for daemon connections.
+func newTransport(opts ClientOptions) (*http.Transport, error) {
+	dialer := &net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if opts.ProxyURL != "" {
+		proxy, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	if opts.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", opts.CABundle)
+		}
+		t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+	}
+	return t, nil
+}
@@ -1,48 +1,192 @@
 package config
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"syscall"
 )
 
 type APIConfig struct {
-	BaseURL     string
-	BearerToken string // For OAuth2/Bearer authentication
-	APIKey      string // For API key authentication
-	BasicAuth   string // For basic authentication
-	Port        string // For server port configuration
+	Name        string     // Endpoint name for logs and metrics, empty for daemons chosen in request headers
+	BaseURL     string     // HTTP URL requests are built from (set by Resolve)
+	Host        string     // Daemon address as configured, e.g. unix:///var/run/docker.sock
+	BearerToken string     // For OAuth2/Bearer authentication
+	APIKey      string     // For API key authentication
+	BasicAuth   string     // For basic authentication
+	Port        string     // For server port configuration
+	TLS         *TLSConfig // Client TLS for the daemon connection, nil for plain connections
+	SSH         *SSHConfig // Credentials and host key checking for ssh:// addresses
+	Client      ClientOptions
+	AuthOptions AuthOptions     // Where BearerToken and APIKey are sent
+	Auth        []Authenticator // Overrides the authenticators built from the fields above
+
+	client      *http.Client
+	transport   *http.Transport // Pools the connections of client
+	sshKey      string          // Shared SSH connection of ssh:// addresses
+	version     *versionTransport
+	dialControl func(network, address string, c syscall.RawConn) error // Checks TCP and SSH connections before they are made
 }
 
 func LoadAPIConfig() (*APIConfig, error) {
 	// Check port environment variable (both uppercase and lowercase)
-	port := os.Getenv("PORT")
+	port := getSetting("PORT")
 	if port == "" {
-		port = os.Getenv("port")
+		port = getSetting("port")
+	}
+
+	baseURL := getSetting("API_BASE_URL")
+	if os.Getenv("API_BASE_URL") == "" && os.Getenv("DOCKER_HOST") != "" {
+		// DOCKER_HOST in the environment overrides daemon.host from the file.
+		baseURL = ""
 	}
-	
-	baseURL := os.Getenv("API_BASE_URL")
-	
+
 	// Check transport environment variable (both uppercase and lowercase)
-	transport := os.Getenv("TRANSPORT")
+	transport := getSetting("TRANSPORT")
 	if transport == "" {
-		transport = os.Getenv("transport")
+		transport = getSetting("transport")
+	}
+
+	isHTTP := false
+	switch strings.ToLower(transport) {
+	case "http", "https", "sse", "combined":
+		isHTTP = true
+	}
+
+	if _, err := pinnedAPIVersion(lookupSetting); err != nil {
+		return nil, err
+	}
+	tlsCfg, err := loadTLSConfig(lookupSetting)
+	if err != nil {
+		return nil, err
 	}
-	
-	// For STDIO mode (transport is not "http"/"HTTP"/"https"/"HTTPS"), API_BASE_URL is required from environment
-	if transport != "http" && transport != "HTTP" && transport != "https" && transport != "HTTPS" && baseURL == "" {
-		return nil, fmt.Errorf("API_BASE_URL environment variable not set")
+	clientOpts, err := loadClientOptions(lookupSetting)
+	if err != nil {
+		return nil, err
 	}
-	
-	// For HTTP/HTTPS mode (transport is "http"/"HTTP"/"https"/"HTTPS"), API_BASE_URL comes from headers
-	// so we don't require it from environment variables
 
-	return &APIConfig{
+	cfg := &APIConfig{
+		Name:        "default",
 		BaseURL:     baseURL,
-		BearerToken: os.Getenv("BEARER_TOKEN"),
-		APIKey:      os.Getenv("API_KEY"),
-		BasicAuth:   os.Getenv("BASIC_AUTH"),
+		BearerToken: getSetting("BEARER_TOKEN"),
+		APIKey:      getSetting("API_KEY"),
+		BasicAuth:   getSetting("BASIC_AUTH"),
 		Port:        port,
-	}, nil
+		TLS:         tlsCfg,
+		SSH:         loadSSHConfig(lookupSetting),
+		Client:      clientOpts,
+		AuthOptions: loadAuthOptions(lookupSetting),
+	}
+
+	// Without API_BASE_URL the daemon is found the way the Docker CLI finds it:
+	// DOCKER_HOST, then DOCKER_CONTEXT or the current context in config.json.
+	// The first DOCKER_ENDPOINTS entry takes precedence over contexts.
+	source := "API_BASE_URL"
+	specs, err := endpointSpecs(currentFile())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BaseURL == "" {
+		if host := getSetting("DOCKER_HOST"); host != "" {
+			source = "DOCKER_HOST"
+			cfg.BaseURL = host
+		} else if len(specs) > 0 {
+			epCfg, err := endpointConfig(specs[0], lookupSetting)
+			if err != nil {
+				return nil, fmt.Errorf("endpoint %q: %w", specs[0].name, err)
+			}
+			source = fmt.Sprintf("endpoint %q", specs[0].name)
+			cfg.BaseURL = epCfg.BaseURL
+			cfg.TLS = epCfg.TLS
+			if specs[0].auth != nil {
+				cfg.BearerToken, cfg.APIKey, cfg.BasicAuth = epCfg.BearerToken, epCfg.APIKey, epCfg.BasicAuth
+				cfg.AuthOptions = epCfg.AuthOptions
+			}
+		} else {
+			name, err := currentContext()
+			if err != nil {
+				return nil, err
+			}
+			if name != "" && name != defaultContextName {
+				ctxCfg, err := dockerContextConfig(name, lookupSetting)
+				if err != nil {
+					return nil, err
+				}
+				source = fmt.Sprintf("context %q", name)
+				cfg.BaseURL = ctxCfg.BaseURL
+				cfg.TLS = ctxCfg.TLS
+			} else if !isHTTP {
+				// For HTTP/HTTPS mode, API_BASE_URL may come from headers instead,
+				// so only STDIO mode falls back to the local socket.
+				source = "default socket"
+				cfg.BaseURL = DefaultHost
+			}
+		}
+	}
+
+	if cfg.BaseURL != "" {
+		if err := cfg.Resolve(); err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+	}
+	return cfg, nil
 }
 
+// contextKey is the context.Context key for a per-call APIConfig.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries cfg. Tool handlers use it in
+// place of the configuration they were built with.
+func NewContext(ctx context.Context, cfg *APIConfig) context.Context {
+	return context.WithValue(ctx, contextKey{}, cfg)
+}
 
+// FromContext returns the APIConfig stored in ctx, or fallback when there is none.
+func FromContext(ctx context.Context, fallback *APIConfig) *APIConfig {
+	if cfg, ok := ctx.Value(contextKey{}).(*APIConfig); ok && cfg != nil {
+		return cfg
+	}
+	return fallback
+}
+
+// LoadHeaderConfig builds the API configuration for an HTTP-mode request from
+// its headers. TLS material is taken from the headers as PEM content. A
+// non-nil allow restricts the daemon addresses the request may name; the
+// error then wraps ErrDaemonNotAllowed.
+func LoadHeaderConfig(h http.Header, allow *DaemonAllowlist) (*APIConfig, error) {
+	cfg := &APIConfig{
+		BaseURL:     h.Get("API_BASE_URL"),
+		BearerToken: h.Get("BEARER_TOKEN"),
+		APIKey:      h.Get("API_KEY"),
+		BasicAuth:   h.Get("BASIC_AUTH"),
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("Missing API_BASE_URL header")
+	}
+	if err := allow.guard(cfg); err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(cfg.BaseURL); err == nil && strings.EqualFold(u.Scheme, "ssh") {
+		// ssh:// would log in with the server's keys and agent.
+		return nil, fmt.Errorf("Invalid API_BASE_URL header: ssh:// daemons cannot be named in headers, configure a named endpoint for them")
+	}
+	tlsCfg, err := loadHeaderTLSConfig(h)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid TLS headers: %w", err)
+	}
+	cfg.TLS = tlsCfg
+	// Client tuning and credential placement stay on the server; clients
+	// only choose the daemon address and credentials, and none of the
+	// server's own TLS or SSH credentials are used for it.
+	cfg.AuthOptions = loadAuthOptions(lookupSetting)
+	if cfg.Client, err = loadClientOptions(lookupSetting); err != nil {
+		return nil, err
+	}
+	if err := cfg.Resolve(); err != nil {
+		return nil, fmt.Errorf("Invalid API_BASE_URL header: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ConfirmMode decides how a destructive tool runs.
+type ConfirmMode string
+
+const (
+	// ConfirmPreview runs the tool only with confirm: true and otherwise
+	// returns what it would affect.
+	ConfirmPreview ConfirmMode = "preview"
+	// ConfirmAllow runs the tool right away.
+	ConfirmAllow ConfirmMode = "allow"
+	// ConfirmDeny refuses every call of the tool.
+	ConfirmDeny ConfirmMode = "deny"
+)
+
+// ConfirmRule sets the mode of the destructive tools matching Pattern, a
+// tool name or path.Match pattern.
+type ConfirmRule struct {
+	Pattern string
+	Mode    ConfirmMode
+}
+
+// ConfirmModes holds the mode of every destructive tool.
+type ConfirmModes struct {
+	Default ConfirmMode
+	Rules   []ConfirmRule
+}
+
+// For returns the mode of the tool called name. A rule naming the tool
+// exactly wins over patterns, which are tried in order.
+func (m ConfirmModes) For(name string) ConfirmMode {
+	for _, rule := range m.Rules {
+		if rule.Pattern == name {
+			return rule.Mode
+		}
+	}
+	for _, rule := range m.Rules {
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			return rule.Mode
+		}
+	}
+	return m.Default
+}
+
+// LoadConfirmModes reads DESTRUCTIVE_MODE, the mode of every destructive
+// tool (preview when unset), and DESTRUCTIVE_TOOLS, comma separated
+// pattern=mode overrides such as "post_swarm_leave=deny,delete_*=allow".
+func LoadConfirmModes() (ConfirmModes, error) {
+	return loadConfirmModes(lookupSetting)
+}
+
+func loadConfirmModes(lookup lookupFunc) (ConfirmModes, error) {
+	modes := ConfirmModes{Default: ConfirmPreview}
+	if val, ok := lookup("DESTRUCTIVE_MODE"); ok && val != "" {
+		mode, err := ParseConfirmMode(val)
+		if err != nil {
+			return modes, fmt.Errorf("DESTRUCTIVE_MODE: %w", err)
+		}
+		modes.Default = mode
+	}
+	val, _ := lookup("DESTRUCTIVE_TOOLS")
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		pattern, modeVal, ok := strings.Cut(item, "=")
+		if !ok {
+			return modes, fmt.Errorf("DESTRUCTIVE_TOOLS: %q is not pattern=mode", item)
+		}
+		pattern = strings.TrimSpace(pattern)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return modes, fmt.Errorf("DESTRUCTIVE_TOOLS: invalid pattern %q", pattern)
+		}
+		mode, err := ParseConfirmMode(modeVal)
+		if err != nil {
+			return modes, fmt.Errorf("DESTRUCTIVE_TOOLS: %s: %w", pattern, err)
+		}
+		modes.Rules = append(modes.Rules, ConfirmRule{Pattern: pattern, Mode: mode})
+	}
+	return modes, nil
+}
+
+// ParseConfirmMode parses "preview", "allow" or "deny".
+func ParseConfirmMode(val string) (ConfirmMode, error) {
+	switch mode := ConfirmMode(strings.ToLower(strings.TrimSpace(val))); mode {
+	case ConfirmPreview, ConfirmAllow, ConfirmDeny:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid mode %q, expected preview, allow or deny", val)
+}
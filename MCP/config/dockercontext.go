@@ -0,0 +1,184 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultContextName is the implicit context that uses DOCKER_HOST or the local socket.
+const defaultContextName = "default"
+
+// contextMeta is the subset of ~/.docker/contexts/meta/<digest>/meta.json we use.
+type contextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// dockerConfigDir returns DOCKER_CONFIG or ~/.docker.
+func dockerConfigDir(lookup lookupFunc) (string, error) {
+	if dir, _ := lookup("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".docker"), nil
+}
+
+// currentContext returns DOCKER_CONTEXT or the currentContext field of
+// config.json, or "" when neither is set.
+func currentContext() (string, error) {
+	if name := getSetting("DOCKER_CONTEXT"); name != "" {
+		return name, nil
+	}
+	dir, err := dockerConfigDir(lookupSetting)
+	if err != nil {
+		return "", nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read Docker config: %w", err)
+	}
+	var cfg struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, "config.json"), err)
+	}
+	return cfg.CurrentContext, nil
+}
+
+// contextDigest is the directory name the Docker CLI stores a context under.
+func contextDigest(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+// dockerContextConfig reads the docker endpoint of a CLI context, including
+// the TLS material stored next to it. It does not resolve the result.
+func dockerContextConfig(name string, lookup lookupFunc) (*APIConfig, error) {
+	if name == defaultContextName {
+		host, _ := lookup("DOCKER_HOST")
+		if host == "" {
+			host = DefaultHost
+		}
+		tlsCfg, err := loadTLSConfig(lookup)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts, err := loadClientOptions(lookup)
+		if err != nil {
+			return nil, err
+		}
+		return &APIConfig{BaseURL: host, TLS: tlsCfg, SSH: loadSSHConfig(lookup), Client: clientOpts}, nil
+	}
+
+	dir, err := dockerConfigDir(lookup)
+	if err != nil {
+		return nil, fmt.Errorf("context %q: %w", name, err)
+	}
+	digest := contextDigest(name)
+	data, err := os.ReadFile(filepath.Join(dir, "contexts", "meta", digest, "meta.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("context %q does not exist", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("context %q: %w", name, err)
+	}
+	var meta contextMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("context %q: invalid meta.json: %w", name, err)
+	}
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok || endpoint.Host == "" {
+		return nil, fmt.Errorf("context %q has no docker endpoint", name)
+	}
+
+	clientOpts, err := loadClientOptions(lookup)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &APIConfig{BaseURL: endpoint.Host, SSH: loadSSHConfig(lookup), Client: clientOpts}
+	tlsDir := filepath.Join(dir, "contexts", "tls", digest, "docker")
+	caCert := defaultCertFile("", tlsDir, "ca.pem")
+	clientCert := defaultCertFile("", tlsDir, "cert.pem")
+	clientKey := defaultCertFile("", tlsDir, "key.pem")
+	if caCert != "" || clientCert != "" || endpoint.SkipTLSVerify {
+		cfg.TLS = &TLSConfig{
+			Verify:     !endpoint.SkipTLSVerify,
+			CACert:     caCert,
+			ClientCert: clientCert,
+			ClientKey:  clientKey,
+		}
+		if err := cfg.TLS.validate(); err != nil {
+			return nil, fmt.Errorf("context %q: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// contextCache keeps one resolved config per context and allowlist so
+// repeated calls share connections. Entries are rebuilt when the context's
+// meta.json changes; a reloaded allowlist gets entries of its own.
+var contextCache = struct {
+	sync.Mutex
+	m map[contextCacheKey]cachedContext
+}{m: make(map[contextCacheKey]cachedContext)}
+
+type contextCacheKey struct {
+	name  string
+	allow *DaemonAllowlist
+}
+
+type cachedContext struct {
+	cfg     *APIConfig
+	modTime time.Time
+}
+
+// LoadDockerContext returns the resolved configuration for a Docker CLI
+// context. A non-nil allow restricts the daemon addresses the context may
+// point at, like those named in headers.
+func LoadDockerContext(name string, allow *DaemonAllowlist) (*APIConfig, error) {
+	var modTime time.Time
+	if name != defaultContextName {
+		if dir, err := dockerConfigDir(lookupSetting); err == nil {
+			if info, err := os.Stat(filepath.Join(dir, "contexts", "meta", contextDigest(name), "meta.json")); err == nil {
+				modTime = info.ModTime()
+			}
+		}
+	}
+
+	contextCache.Lock()
+	defer contextCache.Unlock()
+	key := contextCacheKey{name: name, allow: allow}
+	if cached, ok := contextCache.m[key]; ok && cached.modTime.Equal(modTime) {
+		return cached.cfg, nil
+	}
+	cfg, err := dockerContextConfig(name, lookupSetting)
+	if err != nil {
+		return nil, err
+	}
+	if err := allow.guard(cfg); err != nil {
+		return nil, fmt.Errorf("context %q: %w", name, err)
+	}
+	cfg.Name = "context:" + name
+	if err := cfg.Resolve(); err != nil {
+		return nil, fmt.Errorf("context %q: %w", name, err)
+	}
+	contextCache.m[key] = cachedContext{cfg: cfg, modTime: modTime}
+	return cfg, nil
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// FanOutHost is the host argument value that sends a call to every endpoint.
+const FanOutHost = "*"
+
+var endpointNameRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Endpoint is a named daemon that tool calls can be routed to.
+type Endpoint struct {
+	Name    string
+	Address string     // Daemon address or Docker CLI context name, as configured
+	Config  *APIConfig // Resolved configuration for the endpoint
+}
+
+// Endpoints is the ordered set of named daemons. The first one is the
+// default for calls that do not name a host.
+type Endpoints []Endpoint
+
+// Lookup returns the endpoint with the given name.
+func (e Endpoints) Lookup(name string) (Endpoint, bool) {
+	for _, ep := range e {
+		if ep.Name == name {
+			return ep, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// Names returns the endpoint names in configuration order.
+func (e Endpoints) Names() []string {
+	names := make([]string, len(e))
+	for i, ep := range e {
+		names[i] = ep.Name
+	}
+	return names
+}
+
+// ReuseUnchanged returns next with every endpoint that prev has under the
+// same name, address and settings replaced by the one in prev, so a reload
+// keeps its connections and negotiated API version.
+func ReuseUnchanged(prev, next Endpoints) Endpoints {
+	reused := make(Endpoints, len(next))
+	for i, ep := range next {
+		if old, ok := prev.Lookup(ep.Name); ok && old.Address == ep.Address && old.Config.sameSettings(ep.Config) {
+			ep = old
+		}
+		reused[i] = ep
+	}
+	return reused
+}
+
+// CloseRemoved closes the connections of the endpoints in prev that next
+// no longer uses: their idle HTTP connections, and their SSH connections
+// unless an endpoint in next shares them. Calls still streaming over a
+// closed SSH connection fail.
+func CloseRemoved(prev, next Endpoints) {
+	kept := make(map[*APIConfig]bool)
+	sshKeys := make(map[string]bool)
+	for _, ep := range next {
+		kept[ep.Config] = true
+		sshKeys[ep.Config.sshKey] = true
+	}
+	for _, ep := range prev {
+		cfg := ep.Config
+		if kept[cfg] {
+			continue
+		}
+		if cfg.transport != nil {
+			cfg.transport.CloseIdleConnections()
+		}
+		if cfg.sshKey != "" && !sshKeys[cfg.sshKey] {
+			closeSSH(cfg.sshKey)
+		}
+	}
+}
+
+type endpointSpec struct {
+	name    string
+	address string
+	tls     *FileTLS  // Per-endpoint TLS from the configuration file
+	auth    *FileAuth // Per-endpoint credentials from the configuration file
+}
+
+// endpointSpecs returns the endpoints from DOCKER_ENDPOINTS or, when the
+// variable is not set, from the configuration file f.
+func endpointSpecs(f *File) ([]endpointSpec, error) {
+	if val := os.Getenv("DOCKER_ENDPOINTS"); val != "" {
+		specs, err := parseEndpoints(val)
+		if err != nil {
+			return nil, fmt.Errorf("DOCKER_ENDPOINTS: %w", err)
+		}
+		return specs, nil
+	}
+	return fileEndpoints(f), nil
+}
+
+// parseEndpoints parses DOCKER_ENDPOINTS: comma separated name=address pairs,
+// where address is a daemon address or the name of a Docker CLI context.
+func parseEndpoints(val string) ([]endpointSpec, error) {
+	var specs []endpointSpec
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(val, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, address, ok := strings.Cut(pair, "=")
+		name, address = strings.TrimSpace(name), strings.TrimSpace(address)
+		if !ok || address == "" {
+			return nil, fmt.Errorf("endpoint %q: expected name=address", name)
+		}
+		if !endpointNameRE.MatchString(name) {
+			return nil, fmt.Errorf("endpoint %q: names may only contain letters, digits, '.', '_' and '-'", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("endpoint %q is defined twice", name)
+		}
+		seen[name] = true
+		specs = append(specs, endpointSpec{name: name, address: address})
+	}
+	return specs, nil
+}
+
+// endpointConfig builds the unresolved configuration for one endpoint.
+// Addresses without a scheme name a Docker CLI context; everything else
+// shares the TLS, SSH, client and credential settings of the environment
+// unless the configuration file sets them for this endpoint.
+func endpointConfig(spec endpointSpec, lookup lookupFunc) (*APIConfig, error) {
+	if !strings.Contains(spec.address, "://") {
+		return dockerContextConfig(spec.address, lookup)
+	}
+	lookupTLS := lookup
+	if spec.tls != nil {
+		lookupTLS = mapLookup(spec.tls.settings())
+	}
+	lookupAuth := lookup
+	if spec.auth != nil {
+		lookupAuth = mapLookup(spec.auth.settings())
+	}
+	tlsCfg, err := loadTLSConfig(lookupTLS)
+	if err != nil {
+		return nil, err
+	}
+	clientOpts, err := loadClientOptions(lookup)
+	if err != nil {
+		return nil, err
+	}
+	bearerToken, _ := lookupAuth("BEARER_TOKEN")
+	apiKey, _ := lookupAuth("API_KEY")
+	basicAuth, _ := lookupAuth("BASIC_AUTH")
+	return &APIConfig{
+		BaseURL:     spec.address,
+		BearerToken: bearerToken,
+		APIKey:      apiKey,
+		BasicAuth:   basicAuth,
+		TLS:         tlsCfg,
+		SSH:         loadSSHConfig(lookup),
+		Client:      clientOpts,
+		AuthOptions: loadAuthOptions(lookupAuth),
+	}, nil
+}
+
+// LoadEndpoints reads and resolves the endpoints listed in DOCKER_ENDPOINTS
+// or the configuration file. It returns nil when there are none.
+func LoadEndpoints() (Endpoints, error) {
+	return loadEndpoints(lookupSetting, currentFile())
+}
+
+func loadEndpoints(lookup lookupFunc, f *File) (Endpoints, error) {
+	specs, err := endpointSpecs(f)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints Endpoints
+	for _, spec := range specs {
+		cfg, err := endpointConfig(spec, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %q: %w", spec.name, err)
+		}
+		cfg.Name = spec.name
+		if err := cfg.Resolve(); err != nil {
+			return nil, fmt.Errorf("endpoint %q: %w", spec.name, err)
+		}
+		endpoints = append(endpoints, Endpoint{Name: spec.name, Address: spec.address, Config: cfg})
+	}
+	return endpoints, nil
+}
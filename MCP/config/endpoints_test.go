@@ -0,0 +1,119 @@
+package config
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connTracker serves /_ping and records when its connections close.
+type connTracker struct {
+	mu     sync.Mutex
+	closed int
+}
+
+func (c *connTracker) start(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.41")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			c.mu.Lock()
+			c.closed++
+			c.mu.Unlock()
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func (c *connTracker) closedConns() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func testEndpoint(t *testing.T, name, address string) Endpoint {
+	t.Helper()
+	cfg := &APIConfig{Name: name, BaseURL: address}
+	if err := cfg.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	return Endpoint{Name: name, Address: address, Config: cfg}
+}
+
+func TestReuseUnchangedAndCloseRemoved(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "1.41")
+	var kept, removed connTracker
+	keptURL, removedURL := kept.start(t), removed.start(t)
+	prev := Endpoints{testEndpoint(t, "prod", keptURL), testEndpoint(t, "old", removedURL)}
+	for _, ep := range prev {
+		if _, err := get(t, ep.Config, "/_ping"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	next := ReuseUnchanged(prev, Endpoints{testEndpoint(t, "prod", keptURL), testEndpoint(t, "new", removedURL)})
+	if next[0].Config != prev[0].Config {
+		t.Error("the unchanged endpoint was not reused")
+	}
+	if next[1].Config == prev[1].Config {
+		t.Error("an endpoint under a new name was reused")
+	}
+	changed := testEndpoint(t, "prod", keptURL)
+	changed.Config.BearerToken = "rotated"
+	if got := ReuseUnchanged(prev, Endpoints{changed}); got[0].Config != changed.Config {
+		t.Error("an endpoint with new credentials was reused")
+	}
+
+	CloseRemoved(prev, next)
+	deadline := time.Now().Add(2 * time.Second)
+	for removed.closedConns() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if removed.closedConns() == 0 {
+		t.Error("the idle connection of the removed endpoint is still open")
+	}
+	if n := kept.closedConns(); n != 0 {
+		t.Errorf("%d connections of the kept endpoint were closed", n)
+	}
+}
+
+// LoadReloadable reads a file without making it the active one.
+func TestLoadReloadableDoesNotPublish(t *testing.T) {
+	t.Setenv("DOCKER_ENDPOINTS", "")
+	t.Setenv("ALLOWED_DAEMONS", "")
+	t.Setenv("TOOL_TIMEOUT", "")
+	UseFile(&File{Timeouts: FileTimeouts{Tool: "10s"}})
+	t.Cleanup(func() { UseFile(nil) })
+
+	f := &File{
+		Endpoints: []FileEndpoint{{Name: "prod", Host: "tcp://127.0.0.1:2375"}},
+		Headers:   FileHeaders{AllowedDaemons: []string{"prod"}},
+		Timeouts:  FileTimeouts{Tool: "20s"},
+	}
+	r, err := LoadReloadable(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Endpoints) != 1 || !r.Allow.AllowsEndpoint("prod") || r.Client.DefaultTimeout != 20*time.Second {
+		t.Errorf("LoadReloadable = %+v", r)
+	}
+	if got := Setting("TOOL_TIMEOUT"); got != "10s" {
+		t.Errorf("TOOL_TIMEOUT is %q while the file was only loaded", got)
+	}
+	if endpoints, _ := LoadEndpoints(); len(endpoints) != 0 {
+		t.Errorf("the active endpoints changed to %v", endpoints.Names())
+	}
+
+	f.Headers.AllowedDaemons = []string{"nowhere"}
+	if _, err := LoadReloadable(f); err == nil || !strings.Contains(err.Error(), "ALLOWED_DAEMONS") {
+		t.Errorf("LoadReloadable with a bad allowlist: %v", err)
+	}
+}
@@ -0,0 +1,639 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker-engine-api/mcp-server/models"
+	"gopkg.in/yaml.v3"
+)
+
+// File is the YAML (or JSON) configuration file. Every setting in it has an
+// environment variable counterpart, and variables that are set take
+// precedence over the file.
+type File struct {
+	Listener    FileListener    `yaml:"listener"`
+	ClientAuth  FileClientAuth  `yaml:"client_auth"`
+	Headers     FileHeaders     `yaml:"headers"`
+	Daemon      FileDaemon      `yaml:"daemon"`
+	Endpoints   []FileEndpoint  `yaml:"endpoints"`
+	TLS         FileTLS         `yaml:"tls"`
+	Auth        FileAuth        `yaml:"auth"`
+	SSH         FileSSH         `yaml:"ssh"`
+	HTTP        FileHTTP        `yaml:"http"`
+	Timeouts    FileTimeouts    `yaml:"timeouts"`
+	Tools       FileTools       `yaml:"tools"`
+	Destructive FileDestructive `yaml:"destructive"`
+	Policy      FilePolicy      `yaml:"policy"`
+	Redaction   FileRedaction   `yaml:"redaction"`
+	Limits      FileLimits      `yaml:"limits"`
+	Readiness   FileReadiness   `yaml:"readiness"`
+	Tracing     FileTracing     `yaml:"tracing"`
+	Audit       FileAudit       `yaml:"audit"`
+	Logging     FileLogging     `yaml:"logging"`
+}
+
+type FileListener struct {
+	Transport          string `yaml:"transport"`            // TRANSPORT
+	Port               string `yaml:"port"`                 // PORT
+	CertFile           string `yaml:"cert_file"`            // CERT_FILE
+	KeyFile            string `yaml:"key_file"`             // KEY_FILE
+	SessionIdleTimeout string `yaml:"session_idle_timeout"` // SESSION_IDLE_TIMEOUT
+	MetricsAddr        string `yaml:"metrics_addr"`         // METRICS_ADDR
+	DrainTimeout       string `yaml:"drain_timeout"`        // DRAIN_TIMEOUT
+}
+
+// FileClientAuth configures how MCP clients authenticate in the network modes.
+type FileClientAuth struct {
+	TokensFile string `yaml:"tokens_file"` // CLIENT_TOKENS_FILE
+	CAFile     string `yaml:"ca_file"`     // CLIENT_CA_FILE
+}
+
+// FileHeaders limits the daemons clients may pick with the API_BASE_URL
+// header in the network modes.
+type FileHeaders struct {
+	AllowedDaemons []string `yaml:"allowed_daemons"` // ALLOWED_DAEMONS, comma separated
+	IgnoreBaseURL  bool     `yaml:"ignore_base_url"` // IGNORE_API_BASE_URL_HEADER
+}
+
+type FileDaemon struct {
+	Host       string `yaml:"host"`        // API_BASE_URL
+	Context    string `yaml:"context"`     // DOCKER_CONTEXT
+	APIVersion string `yaml:"api_version"` // DOCKER_API_VERSION
+}
+
+// FileEndpoint is one named daemon; TLS and Auth replace the top-level
+// settings for this endpoint only.
+type FileEndpoint struct {
+	Name string    `yaml:"name"`
+	Host string    `yaml:"host"` // Daemon address or Docker CLI context name
+	TLS  *FileTLS  `yaml:"tls"`
+	Auth *FileAuth `yaml:"auth"`
+}
+
+type FileTLS struct {
+	Verify   bool   `yaml:"verify"`    // DOCKER_TLS_VERIFY
+	CertPath string `yaml:"cert_path"` // DOCKER_CERT_PATH
+	CACert   string `yaml:"ca_cert"`   // DOCKER_TLS_CACERT
+	Cert     string `yaml:"cert"`      // DOCKER_TLS_CERT
+	Key      string `yaml:"key"`       // DOCKER_TLS_KEY
+}
+
+type FileAuth struct {
+	BearerToken      string `yaml:"bearer_token"`        // BEARER_TOKEN
+	APIKey           string `yaml:"api_key"`             // API_KEY
+	BasicAuth        string `yaml:"basic_auth"`          // BASIC_AUTH
+	BearerHeader     string `yaml:"bearer_header"`       // AUTH_BEARER_HEADER
+	APIKeyHeader     string `yaml:"api_key_header"`      // API_KEY_HEADER
+	APIKeyQueryParam string `yaml:"api_key_query_param"` // API_KEY_QUERY_PARAM
+}
+
+type FileSSH struct {
+	KeyFile       string `yaml:"key_file"`       // SSH_KEY_FILE
+	KeyPassphrase string `yaml:"key_passphrase"` // SSH_KEY_PASSPHRASE
+	KnownHosts    string `yaml:"known_hosts"`    // SSH_KNOWN_HOSTS
+	AgentSock     string `yaml:"agent_sock"`     // SSH_AUTH_SOCK
+}
+
+type FileHTTP struct {
+	DialTimeout           string `yaml:"dial_timeout"`            // HTTP_DIAL_TIMEOUT
+	TLSHandshakeTimeout   string `yaml:"tls_handshake_timeout"`   // HTTP_TLS_HANDSHAKE_TIMEOUT
+	ResponseHeaderTimeout string `yaml:"response_header_timeout"` // HTTP_RESPONSE_HEADER_TIMEOUT
+	IdleConnTimeout       string `yaml:"idle_conn_timeout"`       // HTTP_IDLE_CONN_TIMEOUT
+	MaxIdleConnsPerHost   string `yaml:"max_idle_conns_per_host"` // HTTP_MAX_IDLE_CONNS_PER_HOST
+	ProxyURL              string `yaml:"proxy_url"`               // HTTP_PROXY_URL
+	CABundle              string `yaml:"ca_bundle"`               // CA_BUNDLE
+}
+
+type FileTimeouts struct {
+	Tool     string `yaml:"tool"`      // TOOL_TIMEOUT
+	ToolLong string `yaml:"tool_long"` // TOOL_LONG_TIMEOUT
+}
+
+// FileTools selects the tools that are registered. Entries are tool names or
+// path.Match patterns such as "get_*".
+type FileTools struct {
+	Toolsets []string `yaml:"toolsets"`  // TOOLSETS, comma separated
+	Allow    []string `yaml:"allow"`     // TOOLS_ALLOW, comma separated
+	Deny     []string `yaml:"deny"`      // TOOLS_DENY, comma separated
+	ReadOnly bool     `yaml:"read_only"` // READ_ONLY
+}
+
+// FileDestructive decides whether destructive tools (deletes, prunes and
+// leaving the swarm) preview, run or are refused.
+type FileDestructive struct {
+	Mode  string            `yaml:"mode"`  // DESTRUCTIVE_MODE: preview, allow or deny
+	Tools map[string]string `yaml:"tools"` // DESTRUCTIVE_TOOLS, tool name or pattern to mode
+}
+
+// FilePolicy names the rules that containers and services created or
+// updated by tools must follow.
+type FilePolicy struct {
+	File string `yaml:"file"` // POLICY_FILE
+}
+
+// FileRedaction masks secrets in tool results. Redaction is on unless
+// disabled; the listed clients may still turn it off for their own sessions.
+type FileRedaction struct {
+	Disabled      bool     `yaml:"disabled"`       // REDACT_OUTPUT=off
+	EnvPatterns   []string `yaml:"env_patterns"`   // REDACT_ENV_PATTERNS, comma separated
+	OptOutClients []string `yaml:"optout_clients"` // REDACT_OPTOUT_CLIENTS, comma separated
+}
+
+// FileLimits caps tool calls globally, per client and per tool category.
+type FileLimits struct {
+	Global FileLimit `yaml:"global"` // RATE_LIMIT_GLOBAL, MAX_IN_FLIGHT_GLOBAL
+	Client FileLimit `yaml:"client"` // RATE_LIMIT_CLIENT, MAX_IN_FLIGHT_CLIENT
+	Read   FileLimit `yaml:"read"`   // RATE_LIMIT_READ, MAX_IN_FLIGHT_READ
+	Mutate FileLimit `yaml:"mutate"` // RATE_LIMIT_MUTATE, MAX_IN_FLIGHT_MUTATE
+	Stream FileLimit `yaml:"stream"` // RATE_LIMIT_STREAM, MAX_IN_FLIGHT_STREAM
+}
+
+type FileLimit struct {
+	Rate        string `yaml:"rate"` // Calls per period, e.g. "20/s"
+	MaxInFlight int    `yaml:"max_in_flight"`
+}
+
+func (l *FileLimits) scopes() []struct {
+	name  string
+	limit FileLimit
+} {
+	return []struct {
+		name  string
+		limit FileLimit
+	}{
+		{"global", l.Global},
+		{"client", l.Client},
+		{"read", l.Read},
+		{"mutate", l.Mutate},
+		{"stream", l.Stream},
+	}
+}
+
+// FileReadiness configures the /readyz checks.
+type FileReadiness struct {
+	Required []string `yaml:"required"` // READY_REQUIRED_ENDPOINTS, comma separated
+	Timeout  string   `yaml:"timeout"`  // READY_TIMEOUT
+}
+
+// FileTracing configures OpenTelemetry tracing.
+type FileTracing struct {
+	Exporter     string `yaml:"exporter"`      // TRACING_EXPORTER: otlp, stdout, file or none
+	File         string `yaml:"file"`          // TRACING_FILE
+	OTLPEndpoint string `yaml:"otlp_endpoint"` // TRACING_OTLP_ENDPOINT
+}
+
+// FileAudit configures the audit log of state-changing tool calls.
+type FileAudit struct {
+	File      string `yaml:"file"`       // AUDIT_LOG
+	MaxSize   string `yaml:"max_size"`   // AUDIT_LOG_MAX_SIZE, e.g. "100M"
+	MaxFiles  int    `yaml:"max_files"`  // AUDIT_LOG_MAX_FILES
+	HashChain bool   `yaml:"hash_chain"` // AUDIT_LOG_HASH_CHAIN
+}
+
+type FileLogging struct {
+	File      string `yaml:"file"`       // LOG_FILE
+	ToolCalls bool   `yaml:"tool_calls"` // LOG_TOOL_CALLS
+}
+
+// LoadFile reads and validates a configuration file. Errors name the
+// offending field, for example "timeouts.tool: invalid duration".
+func LoadFile(filename string) (*File, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	f := &File{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(f); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			// One line per problem, e.g. "line 3: field listner not found in type config.File".
+			return nil, fmt.Errorf("config file %s: %s", filename, strings.Join(typeErr.Errors, "; "))
+		}
+		return nil, fmt.Errorf("config file %s: %w", filename, err)
+	}
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", filename, err)
+	}
+	return f, nil
+}
+
+func (f *File) validate() error {
+	switch strings.ToLower(f.Listener.Transport) {
+	case "", "stdio", "http", "https", "sse", "combined":
+	default:
+		return fmt.Errorf("listener.transport: %q is not one of stdio, http, https, sse or combined", f.Listener.Transport)
+	}
+	if f.Listener.Port != "" {
+		if n, err := strconv.Atoi(f.Listener.Port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("listener.port: invalid port %q", f.Listener.Port)
+		}
+	}
+	if f.Daemon.Host != "" {
+		if _, _, _, err := parseHost(f.Daemon.Host, false); err != nil {
+			return fmt.Errorf("daemon.host: %w", err)
+		}
+	}
+	if v := strings.TrimPrefix(f.Daemon.APIVersion, "v"); v != "" && !versionRE.MatchString(v) {
+		return fmt.Errorf("daemon.api_version: invalid version %q", f.Daemon.APIVersion)
+	}
+
+	seen := make(map[string]bool)
+	for i, ep := range f.Endpoints {
+		field := fmt.Sprintf("endpoints[%d]", i)
+		if !endpointNameRE.MatchString(ep.Name) {
+			return fmt.Errorf("%s.name: %q may only contain letters, digits, '.', '_' and '-'", field, ep.Name)
+		}
+		if seen[ep.Name] {
+			return fmt.Errorf("%s.name: %q is defined twice", field, ep.Name)
+		}
+		seen[ep.Name] = true
+		if ep.Host == "" {
+			return fmt.Errorf("%s.host: missing", field)
+		}
+		if strings.Contains(ep.Host, "://") {
+			if _, _, _, err := parseHost(ep.Host, ep.TLS != nil); err != nil {
+				return fmt.Errorf("%s.host: %w", field, err)
+			}
+		}
+		if ep.TLS != nil {
+			if _, err := loadTLSConfig(mapLookup(ep.TLS.settings())); err != nil {
+				return fmt.Errorf("%s.tls: %w", field, err)
+			}
+		}
+	}
+
+	durations := []struct {
+		field string
+		val   string
+	}{
+		{"listener.session_idle_timeout", f.Listener.SessionIdleTimeout},
+		{"listener.drain_timeout", f.Listener.DrainTimeout},
+		{"http.dial_timeout", f.HTTP.DialTimeout},
+		{"http.tls_handshake_timeout", f.HTTP.TLSHandshakeTimeout},
+		{"http.response_header_timeout", f.HTTP.ResponseHeaderTimeout},
+		{"http.idle_conn_timeout", f.HTTP.IdleConnTimeout},
+		{"timeouts.tool", f.Timeouts.Tool},
+		{"timeouts.tool_long", f.Timeouts.ToolLong},
+		{"readiness.timeout", f.Readiness.Timeout},
+	}
+	for _, d := range durations {
+		if d.val == "" {
+			continue
+		}
+		if _, err := ParseDuration(d.val); err != nil {
+			return fmt.Errorf("%s: %w", d.field, err)
+		}
+	}
+	if f.HTTP.MaxIdleConnsPerHost != "" {
+		if n, err := strconv.Atoi(f.HTTP.MaxIdleConnsPerHost); err != nil || n < 0 {
+			return fmt.Errorf("http.max_idle_conns_per_host: invalid count %q", f.HTTP.MaxIdleConnsPerHost)
+		}
+	}
+	if _, err := loadTLSConfig(mapLookup(f.TLS.settings())); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if f.Audit.MaxSize != "" {
+		if _, err := ParseSize(f.Audit.MaxSize); err != nil {
+			return fmt.Errorf("audit.max_size: %w", err)
+		}
+	}
+	if f.Audit.MaxFiles < 0 {
+		return fmt.Errorf("audit.max_files: invalid count %d", f.Audit.MaxFiles)
+	}
+	switch strings.ToLower(f.Tracing.Exporter) {
+	case "", "none", "otlp", "stdout":
+	case "file":
+		if f.Tracing.File == "" {
+			return fmt.Errorf("tracing.file: missing, required by the file exporter")
+		}
+	default:
+		return fmt.Errorf("tracing.exporter: %q is not one of otlp, stdout, file or none", f.Tracing.Exporter)
+	}
+	for _, scope := range f.Limits.scopes() {
+		if scope.limit.Rate != "" {
+			if _, _, err := ParseRate(scope.limit.Rate); err != nil {
+				return fmt.Errorf("limits.%s.rate: %w", scope.name, err)
+			}
+		}
+		if scope.limit.MaxInFlight < 0 {
+			return fmt.Errorf("limits.%s.max_in_flight: invalid count %d", scope.name, scope.limit.MaxInFlight)
+		}
+	}
+	for i, name := range f.Tools.Toolsets {
+		if !slices.Contains(models.Toolsets, name) {
+			return fmt.Errorf("tools.toolsets[%d]: unknown toolset %q, expected one of %s", i, name, strings.Join(models.Toolsets, ", "))
+		}
+	}
+	if f.Destructive.Mode != "" {
+		if _, err := ParseConfirmMode(f.Destructive.Mode); err != nil {
+			return fmt.Errorf("destructive.mode: %w", err)
+		}
+	}
+	for pattern, mode := range f.Destructive.Tools {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" || strings.ContainsAny(pattern, ",=") {
+			return fmt.Errorf("destructive.tools: invalid pattern %q", pattern)
+		}
+		if _, err := ParseConfirmMode(mode); err != nil {
+			return fmt.Errorf("destructive.tools.%s: %w", pattern, err)
+		}
+	}
+	for i, pattern := range f.Redaction.EnvPatterns {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" || strings.Contains(pattern, ",") {
+			return fmt.Errorf("redaction.env_patterns[%d]: invalid pattern %q", i, pattern)
+		}
+	}
+	for i, pattern := range f.Tools.Allow {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("tools.allow[%d]: invalid pattern %q", i, pattern)
+		}
+	}
+	for i, pattern := range f.Tools.Deny {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("tools.deny[%d]: invalid pattern %q", i, pattern)
+		}
+	}
+	return nil
+}
+
+func (t *FileTLS) settings() map[string]string {
+	m := map[string]string{
+		"DOCKER_CERT_PATH":  t.CertPath,
+		"DOCKER_TLS_CACERT": t.CACert,
+		"DOCKER_TLS_CERT":   t.Cert,
+		"DOCKER_TLS_KEY":    t.Key,
+	}
+	if t.Verify {
+		m["DOCKER_TLS_VERIFY"] = "1"
+	}
+	return m
+}
+
+func (a *FileAuth) settings() map[string]string {
+	return map[string]string{
+		"BEARER_TOKEN":        a.BearerToken,
+		"API_KEY":             a.APIKey,
+		"BASIC_AUTH":          a.BasicAuth,
+		"AUTH_BEARER_HEADER":  a.BearerHeader,
+		"API_KEY_HEADER":      a.APIKeyHeader,
+		"API_KEY_QUERY_PARAM": a.APIKeyQueryParam,
+	}
+}
+
+// settings flattens the file into the environment variables it stands in for.
+func (f *File) settings() map[string]string {
+	m := map[string]string{
+		"TRANSPORT":                    f.Listener.Transport,
+		"PORT":                         f.Listener.Port,
+		"CERT_FILE":                    f.Listener.CertFile,
+		"KEY_FILE":                     f.Listener.KeyFile,
+		"SESSION_IDLE_TIMEOUT":         f.Listener.SessionIdleTimeout,
+		"METRICS_ADDR":                 f.Listener.MetricsAddr,
+		"DRAIN_TIMEOUT":                f.Listener.DrainTimeout,
+		"CLIENT_TOKENS_FILE":           f.ClientAuth.TokensFile,
+		"CLIENT_CA_FILE":               f.ClientAuth.CAFile,
+		"ALLOWED_DAEMONS":              strings.Join(f.Headers.AllowedDaemons, ","),
+		"API_BASE_URL":                 f.Daemon.Host,
+		"DOCKER_CONTEXT":               f.Daemon.Context,
+		"DOCKER_API_VERSION":           f.Daemon.APIVersion,
+		"SSH_KEY_FILE":                 f.SSH.KeyFile,
+		"SSH_KEY_PASSPHRASE":           f.SSH.KeyPassphrase,
+		"SSH_KNOWN_HOSTS":              f.SSH.KnownHosts,
+		"SSH_AUTH_SOCK":                f.SSH.AgentSock,
+		"HTTP_DIAL_TIMEOUT":            f.HTTP.DialTimeout,
+		"HTTP_TLS_HANDSHAKE_TIMEOUT":   f.HTTP.TLSHandshakeTimeout,
+		"HTTP_RESPONSE_HEADER_TIMEOUT": f.HTTP.ResponseHeaderTimeout,
+		"HTTP_IDLE_CONN_TIMEOUT":       f.HTTP.IdleConnTimeout,
+		"HTTP_MAX_IDLE_CONNS_PER_HOST": f.HTTP.MaxIdleConnsPerHost,
+		"HTTP_PROXY_URL":               f.HTTP.ProxyURL,
+		"CA_BUNDLE":                    f.HTTP.CABundle,
+		"TOOL_TIMEOUT":                 f.Timeouts.Tool,
+		"TOOL_LONG_TIMEOUT":            f.Timeouts.ToolLong,
+		"TOOLSETS":                     strings.Join(f.Tools.Toolsets, ","),
+		"TOOLS_ALLOW":                  strings.Join(f.Tools.Allow, ","),
+		"TOOLS_DENY":                   strings.Join(f.Tools.Deny, ","),
+		"DESTRUCTIVE_MODE":             f.Destructive.Mode,
+		"POLICY_FILE":                  f.Policy.File,
+		"REDACT_ENV_PATTERNS":          strings.Join(f.Redaction.EnvPatterns, ","),
+		"REDACT_OPTOUT_CLIENTS":        strings.Join(f.Redaction.OptOutClients, ","),
+		"READY_REQUIRED_ENDPOINTS":     strings.Join(f.Readiness.Required, ","),
+		"READY_TIMEOUT":                f.Readiness.Timeout,
+		"TRACING_EXPORTER":             f.Tracing.Exporter,
+		"TRACING_FILE":                 f.Tracing.File,
+		"TRACING_OTLP_ENDPOINT":        f.Tracing.OTLPEndpoint,
+		"AUDIT_LOG":                    f.Audit.File,
+		"AUDIT_LOG_MAX_SIZE":           f.Audit.MaxSize,
+		"LOG_FILE":                     f.Logging.File,
+	}
+	for _, scope := range f.Limits.scopes() {
+		suffix := strings.ToUpper(scope.name)
+		m["RATE_LIMIT_"+suffix] = scope.limit.Rate
+		if scope.limit.MaxInFlight > 0 {
+			m["MAX_IN_FLIGHT_"+suffix] = strconv.Itoa(scope.limit.MaxInFlight)
+		}
+	}
+	if f.Audit.MaxFiles > 0 {
+		m["AUDIT_LOG_MAX_FILES"] = strconv.Itoa(f.Audit.MaxFiles)
+	}
+	if f.Audit.HashChain {
+		m["AUDIT_LOG_HASH_CHAIN"] = "1"
+	}
+	if f.Headers.IgnoreBaseURL {
+		m["IGNORE_API_BASE_URL_HEADER"] = "1"
+	}
+	if f.Logging.ToolCalls {
+		m["LOG_TOOL_CALLS"] = "1"
+	}
+	if len(f.Destructive.Tools) > 0 {
+		rules := make([]string, 0, len(f.Destructive.Tools))
+		for pattern, mode := range f.Destructive.Tools {
+			rules = append(rules, pattern+"="+mode)
+		}
+		slices.Sort(rules)
+		m["DESTRUCTIVE_TOOLS"] = strings.Join(rules, ",")
+	}
+	if f.Tools.ReadOnly {
+		m["READ_ONLY"] = "1"
+	}
+	if f.Redaction.Disabled {
+		m["REDACT_OUTPUT"] = "off"
+	}
+	for k, v := range f.TLS.settings() {
+		m[k] = v
+	}
+	for k, v := range f.Auth.settings() {
+		m[k] = v
+	}
+	return m
+}
+
+func mapLookup(m map[string]string) lookupFunc {
+	return func(key string) (string, bool) {
+		val, ok := m[key]
+		return val, ok && val != ""
+	}
+}
+
+// activeFile is the configuration file in use, nil when there is none.
+var activeFile = struct {
+	sync.RWMutex
+	file     *File
+	settings map[string]string
+}{}
+
+// UseFile makes f the configuration file that settings fall back to. It may
+// be called again to apply a reloaded file.
+func UseFile(f *File) {
+	activeFile.Lock()
+	defer activeFile.Unlock()
+	activeFile.file = f
+	activeFile.settings = nil
+	if f != nil {
+		activeFile.settings = f.settings()
+	}
+}
+
+// Reloadable holds the settings a running server applies on reload.
+type Reloadable struct {
+	Endpoints Endpoints
+	Allow     *DaemonAllowlist
+	Limits    Limits
+	Client    ClientOptions
+}
+
+// LoadReloadable reads the settings a reload applies from the environment
+// and f without making f the active file, so a file that fails any of them
+// is rejected before anything uses it.
+func LoadReloadable(f *File) (Reloadable, error) {
+	lookup := fileLookup(f)
+	var r Reloadable
+	var err error
+	if r.Endpoints, err = loadEndpoints(lookup, f); err != nil {
+		return Reloadable{}, err
+	}
+	if r.Allow, err = loadDaemonAllowlist(lookup, r.Endpoints); err != nil {
+		return Reloadable{}, err
+	}
+	if r.Limits, err = loadLimits(lookup); err != nil {
+		return Reloadable{}, err
+	}
+	if r.Client, err = loadClientOptions(lookup); err != nil {
+		return Reloadable{}, err
+	}
+	if _, err = loadToolsets(lookup); err != nil {
+		return Reloadable{}, err
+	}
+	return r, nil
+}
+
+// lookupSetting returns the environment variable key if it is set and not
+// empty, otherwise the corresponding value from the configuration file.
+func lookupSetting(key string) (string, bool) {
+	if val, ok := os.LookupEnv(key); ok && val != "" {
+		return val, true
+	}
+	activeFile.RLock()
+	defer activeFile.RUnlock()
+	val, ok := activeFile.settings[key]
+	return val, ok && val != ""
+}
+
+// fileLookup is lookupSetting for f instead of the active file, so the
+// settings of a reloaded file can be checked before it is made active.
+func fileLookup(f *File) lookupFunc {
+	settings := f.settings()
+	return func(key string) (string, bool) {
+		if val, ok := os.LookupEnv(key); ok && val != "" {
+			return val, true
+		}
+		val, ok := settings[key]
+		return val, ok && val != ""
+	}
+}
+
+// Setting returns a setting from the environment or f, whether or not f is
+// the active file.
+func (f *File) Setting(key string) string {
+	val, _ := fileLookup(f)(key)
+	return val
+}
+
+func getSetting(key string) string {
+	val, _ := lookupSetting(key)
+	return val
+}
+
+// Setting returns a setting from the environment or the configuration file.
+func Setting(key string) string {
+	return getSetting(key)
+}
+
+// ParseBool reads an on/off value: 1, true, yes and on turn a setting on,
+// 0, false, no and off turn it off, in any case. ok is false for any other
+// value, including an empty one.
+func ParseBool(val string) (on, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(val)) {
+	case "1", "true", "yes", "on":
+		return true, true
+	case "0", "false", "no", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// SettingBool reports whether an on/off setting is turned on. An unset
+// setting is off; a value ParseBool does not know counts as on, so a
+// misspelled READ_ONLY does not leave the server writable.
+func SettingBool(key string) bool {
+	val := getSetting(key)
+	if val == "" {
+		return false
+	}
+	on, ok := ParseBool(val)
+	return on || !ok
+}
+
+// SettingList returns a comma separated setting as a list, skipping empty entries.
+func SettingList(key string) []string {
+	return settingList(lookupSetting, key)
+}
+
+func settingList(lookup lookupFunc, key string) []string {
+	val, _ := lookup(key)
+	var list []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// currentFile returns the active configuration file, nil when there is none.
+func currentFile() *File {
+	activeFile.RLock()
+	defer activeFile.RUnlock()
+	return activeFile.file
+}
+
+// fileEndpoints returns the endpoints of a configuration file as specs.
+func fileEndpoints(f *File) []endpointSpec {
+	if f == nil {
+		return nil
+	}
+	specs := make([]endpointSpec, 0, len(f.Endpoints))
+	for _, ep := range f.Endpoints {
+		specs = append(specs, endpointSpec{name: ep.Name, address: ep.Host, tls: ep.TLS, auth: ep.Auth})
+	}
+	return specs
+}
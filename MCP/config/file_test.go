@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestSettingBool(t *testing.T) {
+	tests := []struct {
+		val string
+		on  bool
+	}{
+		{"", false},
+		{"1", true},
+		{"true", true},
+		{"Yes", true},
+		{" ON ", true},
+		{"0", false},
+		{"false", false},
+		{"FALSE", false},
+		{"no", false},
+		{"off", false},
+		{"enabled", true}, // Unknown values keep the switch on
+	}
+	for _, tt := range tests {
+		t.Setenv("READ_ONLY", tt.val)
+		if got := SettingBool("READ_ONLY"); got != tt.on {
+			t.Errorf("READ_ONLY=%q: on %t, want %t", tt.val, got, tt.on)
+		}
+		if got := ReadOnly(); got != tt.on {
+			t.Errorf("READ_ONLY=%q: ReadOnly() = %t, want %t", tt.val, got, tt.on)
+		}
+	}
+}
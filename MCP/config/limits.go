@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit caps the tool calls in one scope. Zero fields mean no limit.
+type Limit struct {
+	Rate        float64 // Calls per second, refilled continuously
+	Burst       int     // Calls that may be made at once before Rate applies
+	MaxInFlight int     // Calls running at the same time
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 || l.MaxInFlight > 0
+}
+
+// Limits holds the tool call limits of each scope. A call must fit within
+// the global limit, the limit of its client and the limit of its category.
+type Limits struct {
+	Global Limit
+	Client Limit // Per authenticated client, or per remote address without client authentication
+	Read   Limit
+	Mutate Limit
+	Stream Limit // Long-running calls: logs, stats, events, pulls and pushes
+}
+
+// Scopes returns the limits by scope name, in a fixed order.
+func (l *Limits) Scopes() []struct {
+	Name  string
+	Limit *Limit
+} {
+	return []struct {
+		Name  string
+		Limit *Limit
+	}{
+		{"global", &l.Global},
+		{"client", &l.Client},
+		{"read", &l.Read},
+		{"mutate", &l.Mutate},
+		{"stream", &l.Stream},
+	}
+}
+
+// LoadLimits reads RATE_LIMIT_<SCOPE> and MAX_IN_FLIGHT_<SCOPE> for the
+// scopes GLOBAL, CLIENT, READ, MUTATE and STREAM.
+func LoadLimits() (Limits, error) {
+	return loadLimits(lookupSetting)
+}
+
+func loadLimits(lookup lookupFunc) (Limits, error) {
+	var limits Limits
+	for _, scope := range limits.Scopes() {
+		suffix := strings.ToUpper(scope.Name)
+		if val, ok := lookup("RATE_LIMIT_" + suffix); ok && val != "" {
+			rate, burst, err := ParseRate(val)
+			if err != nil {
+				return limits, fmt.Errorf("RATE_LIMIT_%s: %w", suffix, err)
+			}
+			scope.Limit.Rate, scope.Limit.Burst = rate, burst
+		}
+		if val, ok := lookup("MAX_IN_FLIGHT_" + suffix); ok && val != "" {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return limits, fmt.Errorf("MAX_IN_FLIGHT_%s: invalid count %q", suffix, val)
+			}
+			scope.Limit.MaxInFlight = n
+		}
+	}
+	return limits, nil
+}
+
+// ParseRate parses a rate such as "20/s", "100/m" or "5/10s": that many calls
+// per period, which is also the burst size.
+func ParseRate(val string) (rate float64, burst int, err error) {
+	count, period, ok := strings.Cut(val, "/")
+	n, convErr := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || convErr != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q, expected calls/period such as 20/s", val)
+	}
+	period = strings.TrimSpace(period)
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q, expected calls/period such as 20/s", val)
+	}
+	return float64(n) / d.Seconds(), n, nil
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RequestObserver is told about every request sent to a daemon. endpoint is
+// the APIConfig's Name; resp is nil when err is set.
+type RequestObserver func(endpoint string, req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+
+var requestObserver atomic.Pointer[RequestObserver]
+
+// SetRequestObserver installs fn for the requests of every daemon client,
+// including those resolved before the call.
+func SetRequestObserver(fn RequestObserver) {
+	requestObserver.Store(&fn)
+}
+
+// TransportMiddleware wraps the transport of the daemon named endpoint.
+type TransportMiddleware func(endpoint string, next http.RoundTripper) http.RoundTripper
+
+var transportMiddleware atomic.Pointer[TransportMiddleware]
+
+// SetTransportMiddleware wraps the transports of daemon clients with fn. Only
+// clients resolved after the call are wrapped.
+func SetTransportMiddleware(fn TransportMiddleware) {
+	transportMiddleware.Store(&fn)
+}
+
+// observedTransport reports each round trip to the RequestObserver.
+type observedTransport struct {
+	next http.RoundTripper
+	cfg  *APIConfig
+}
+
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	observe := requestObserver.Load()
+	if observe == nil {
+		return t.next.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	(*observe)(t.cfg.Name, req, resp, err, time.Since(start))
+	return resp, err
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ErrReadOnly is returned for requests that would change daemon state while
+// the server is in read-only mode.
+var ErrReadOnly = errors.New("read-only mode")
+
+// readOnlyPostRE matches the POST endpoints that do not change daemon state:
+// waiting for a container and checking registry credentials.
+var readOnlyPostRE = regexp.MustCompile(`/(containers/[^/]+/wait|auth)$`)
+
+// ReadOnly reports whether READ_ONLY is turned on.
+func ReadOnly() bool {
+	return SettingBool("READ_ONLY")
+}
+
+// readOnlyTransport refuses requests that change daemon state while
+// ReadOnly is set. It backs up the tool filtering, so a tool that is
+// registered by mistake still cannot modify the daemon.
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if ReadOnly() && !readOnlyRequest(req.Method, req.URL.Path) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w: %s %s is not allowed", ErrReadOnly, req.Method, req.URL.Path)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// readOnlyRequest reports whether a request to path leaves the daemon
+// unchanged. Attaching over a websocket is a GET but can write to stdin.
+func readOnlyRequest(method, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return !strings.HasSuffix(path, "/attach/ws")
+	case http.MethodPost:
+		return readOnlyPostRE.MatchString(path)
+	}
+	return false
+}
@@ -0,0 +1,377 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultRemoteSocket is the daemon socket dialed on the remote host when the
+// ssh:// address has no path.
+const defaultRemoteSocket = "/var/run/docker.sock"
+
+// SSHConfig holds the settings for ssh:// daemon addresses.
+type SSHConfig struct {
+	KeyFile    string // Private key file; the default ~/.ssh/id_* keys are tried when empty
+	Passphrase string // Passphrase for KeyFile, if it is encrypted
+	KnownHosts string // known_hosts file used to verify the host key, ~/.ssh/known_hosts when empty
+	AgentSock  string // ssh-agent socket, usually SSH_AUTH_SOCK
+}
+
+func loadSSHConfig(lookup lookupFunc) *SSHConfig {
+	keyFile, _ := lookup("SSH_KEY_FILE")
+	passphrase, _ := lookup("SSH_KEY_PASSPHRASE")
+	knownHosts, _ := lookup("SSH_KNOWN_HOSTS")
+	agentSock, _ := lookup("SSH_AUTH_SOCK")
+	return &SSHConfig{
+		KeyFile:    keyFile,
+		Passphrase: passphrase,
+		KnownHosts: knownHosts,
+		AgentSock:  agentSock,
+	}
+}
+
+// sshTarget is a parsed ssh://user@host[:port][/socket] address.
+type sshTarget struct {
+	user   string
+	addr   string
+	socket string
+}
+
+func parseSSHHost(u *url.URL) (*sshTarget, error) {
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+	t := &sshTarget{
+		user:   u.User.Username(),
+		addr:   u.Host,
+		socket: u.Path,
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return nil, fmt.Errorf("passwords are not supported in ssh:// addresses, use a key or an agent")
+	}
+	if t.user == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("no user given and the current user is unknown: %w", err)
+		}
+		t.user = current.Username
+	}
+	if u.Port() == "" {
+		t.addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	if t.socket == "" || t.socket == "/" {
+		t.socket = defaultRemoteSocket
+	}
+	return t, nil
+}
+
+// sshClients shares one SSH connection per target and credentials across all
+// tool calls; each daemon request opens a new channel on it. The lock only
+// guards the map: connections are made outside it, so a slow host holds up
+// only the calls waiting for that host.
+var sshClients = struct {
+	sync.Mutex
+	m map[string]*sshConn
+}{m: make(map[string]*sshConn)}
+
+// sshConn is a shared connection; ready is closed once client or err is set.
+type sshConn struct {
+	ready  chan struct{}
+	client *ssh.Client
+	err    error
+}
+
+// connected returns the client, nil while the connection is being made.
+func (c *sshConn) connected() *ssh.Client {
+	select {
+	case <-c.ready:
+		return c.client
+	default:
+		return nil
+	}
+}
+
+// sshDialer dials the remote daemon socket through a shared SSH connection.
+type sshDialer struct {
+	target  *sshTarget
+	cfg     *SSHConfig
+	key     string
+	timeout time.Duration
+	control func(network, address string, c syscall.RawConn) error // Checks the dialed address, see DaemonAllowlist
+}
+
+func newSSHDialer(target *sshTarget, cfg *SSHConfig, timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *sshDialer {
+	if cfg == nil {
+		cfg = &SSHConfig{}
+	}
+	// Checked and unchecked connections are not shared, so an address a
+	// client chose never reuses a connection whose address was not checked.
+	key := strings.Join([]string{target.user, target.addr, cfg.KeyFile, cfg.KnownHosts, cfg.AgentSock, strconv.FormatBool(control != nil)}, "|")
+	return &sshDialer{target: target, cfg: cfg, key: key, timeout: timeout, control: control}
+}
+
+func (d *sshDialer) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	client, err := d.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("unix", d.target.socket)
+	if err == nil {
+		return conn, nil
+	}
+	var rejected *ssh.OpenChannelError
+	if errors.As(err, &rejected) || client.alive() {
+		// The remote side refused the channel, for example because the
+		// socket is missing; the connection and its other streams are fine.
+		return nil, fmt.Errorf("ssh %s: failed to reach %s on the remote host: %w", d.target.addr, d.target.socket, err)
+	}
+	// The shared connection is gone; reconnect once before giving up.
+	d.drop(client.Client)
+	client, err = d.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err = client.Dial("unix", d.target.socket)
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s: failed to reach %s on the remote host: %w", d.target.addr, d.target.socket, err)
+	}
+	return conn, nil
+}
+
+// sshClient is a shared connection as handed to callers.
+type sshClient struct {
+	*ssh.Client
+}
+
+// keepaliveTimeout bounds how long alive waits for the remote side to answer.
+var keepaliveTimeout = 5 * time.Second
+
+// alive reports whether the connection still answers requests. One that does
+// not answer within keepaliveTimeout counts as dead; closing it, as callers
+// then do, ends the pending request.
+func (c sshClient) alive() bool {
+	answered := make(chan error, 1)
+	go func() {
+		_, _, err := c.SendRequest("keepalive@openssh.com", true, nil)
+		answered <- err
+	}()
+	timer := time.NewTimer(keepaliveTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-answered:
+		return err == nil
+	case <-timer.C:
+		return false
+	}
+}
+
+// client returns the shared connection, connecting when there is none. Calls
+// for the same key wait for one connection attempt, or for their ctx.
+func (d *sshDialer) client(ctx context.Context) (sshClient, error) {
+	sshClients.Lock()
+	conn, ok := sshClients.m[d.key]
+	if !ok {
+		conn = &sshConn{ready: make(chan struct{})}
+		sshClients.m[d.key] = conn
+		go d.open(ctx, conn)
+	}
+	sshClients.Unlock()
+
+	select {
+	case <-conn.ready:
+		return sshClient{conn.client}, conn.err
+	case <-ctx.Done():
+		return sshClient{}, fmt.Errorf("ssh %s: %w", d.target.addr, ctx.Err())
+	}
+}
+
+// open connects conn. It outlives the call that started it, since other
+// calls may be waiting, so only the dial timeout bounds it.
+func (d *sshDialer) open(ctx context.Context, conn *sshConn) {
+	ctx = context.WithoutCancel(ctx)
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	conn.client, conn.err = d.connect(ctx)
+	if conn.err != nil {
+		// Failures are not cached, so the next call tries again.
+		sshClients.Lock()
+		if sshClients.m[d.key] == conn {
+			delete(sshClients.m, d.key)
+		}
+		sshClients.Unlock()
+		close(conn.ready)
+		return
+	}
+	close(conn.ready)
+	go func() {
+		// Forget the connection once it closes so the next call reconnects.
+		conn.client.Wait()
+		d.drop(conn.client)
+	}()
+}
+
+// closeSSH closes the shared connection stored under key, if any.
+func closeSSH(key string) {
+	sshClients.Lock()
+	conn, ok := sshClients.m[key]
+	delete(sshClients.m, key)
+	sshClients.Unlock()
+	if ok {
+		if c := conn.connected(); c != nil {
+			c.Close()
+		}
+	}
+}
+
+func (d *sshDialer) drop(c *ssh.Client) {
+	sshClients.Lock()
+	if conn, ok := sshClients.m[d.key]; ok && conn.connected() == c {
+		delete(sshClients.m, d.key)
+	}
+	sshClients.Unlock()
+	c.Close()
+}
+
+func (d *sshDialer) connect(ctx context.Context) (*ssh.Client, error) {
+	hostKeyCallback, err := d.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	auth, closeAgent, err := d.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+
+	dialer := net.Dialer{Timeout: d.timeout, Control: d.control}
+	conn, err := dialer.DialContext(ctx, "tcp", d.target.addr)
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s: %w", d.target.addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, d.target.addr, &ssh.ClientConfig{
+		User:            d.target.user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         d.timeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh %s@%s: %w", d.target.user, d.target.addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+func (d *sshDialer) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	path := d.cfg.KnownHosts
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot locate known_hosts, set SSH_KNOWN_HOSTS: %w", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts %s: %w", path, err)
+	}
+	return callback, nil
+}
+
+// authMethods collects agent and key file authentication. The returned
+// function closes the agent connection once the handshake is done.
+func (d *sshDialer) authMethods() ([]ssh.AuthMethod, func(), error) {
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+
+	if d.cfg.AgentSock != "" {
+		conn, err := net.Dial("unix", d.cfg.AgentSock)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to ssh-agent at %s: %w", d.cfg.AgentSock, err)
+		}
+		closeAgent = func() { conn.Close() }
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+
+	keyFiles := []string{d.cfg.KeyFile}
+	if d.cfg.KeyFile == "" {
+		keyFiles = defaultKeyFiles()
+	}
+	var signers []ssh.Signer
+	for _, path := range keyFiles {
+		signer, err := loadSigner(path, d.cfg.Passphrase)
+		if err != nil {
+			if d.cfg.KeyFile == "" {
+				// Default keys are best effort; encrypted ones are left to the agent.
+				continue
+			}
+			closeAgent()
+			return nil, nil, err
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if len(methods) == 0 {
+		closeAgent()
+		return nil, nil, fmt.Errorf("no SSH credentials: set SSH_KEY_FILE or SSH_AUTH_SOCK")
+	}
+	return methods, closeAgent, nil
+}
+
+func defaultKeyFiles() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+func loadSigner(path, passphrase string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %w", err)
+	}
+	if passphrase != "" {
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH key %s: %w", path, err)
+		}
+		return signer, nil
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key %s: %w", path, err)
+	}
+	return signer, nil
+}
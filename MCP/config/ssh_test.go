@@ -0,0 +1,339 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an in-process SSH server that forwards
+// direct-streamlocal channels to the unix sockets of the test.
+type testSSHServer struct {
+	addr       string
+	keyFile    string // Client key the server accepts
+	knownHosts string // known_hosts file with the server's host key
+	handshakes atomic.Int32
+	silent     atomic.Bool // Leave global requests such as keepalives unanswered
+}
+
+func startSSHServer(t *testing.T) *testSSHServer {
+	t.Helper()
+	keyFile := writeTestKey(t)
+	signer, err := loadSigner(keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey := signer.PublicKey()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &testSSHServer{addr: l.Addr().String(), keyFile: keyFile}
+	s.knownHosts = filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, hostKey.PublicKey())
+	if err := os.WriteFile(s.knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, cfg)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	s.handshakes.Add(1)
+	go func() {
+		for req := range reqs {
+			if req.WantReply && !s.silent.Load() {
+				req.Reply(false, nil)
+			}
+		}
+	}()
+	for ch := range chans {
+		if ch.ChannelType() != "direct-streamlocal@openssh.com" {
+			ch.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		var msg struct {
+			Path      string
+			Reserved0 string
+			Reserved1 uint32
+		}
+		if err := ssh.Unmarshal(ch.ExtraData(), &msg); err != nil {
+			ch.Reject(ssh.ConnectionFailed, "bad request")
+			continue
+		}
+		local, err := net.Dial("unix", msg.Path)
+		if err != nil {
+			ch.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, chReqs, err := ch.Accept()
+		if err != nil {
+			local.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			defer channel.Close()
+			defer local.Close()
+			go io.Copy(local, channel)
+			io.Copy(channel, local)
+		}()
+	}
+}
+
+// startUnixDaemon serves a fake /_ping on a unix socket and returns its path.
+func startUnixDaemon(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "sshtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.30")
+		io.WriteString(w, "OK "+r.URL.Path)
+	})}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return socket
+}
+
+func resetSSHClients(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		sshClients.Lock()
+		for key, conn := range sshClients.m {
+			if c := conn.connected(); c != nil {
+				c.Close()
+			}
+			delete(sshClients.m, key)
+		}
+		sshClients.Unlock()
+	})
+}
+
+func (s *testSSHServer) config(t *testing.T, socket string) *APIConfig {
+	t.Helper()
+	cfg := &APIConfig{
+		BaseURL: "ssh://deploy@" + s.addr + socket,
+		SSH:     &SSHConfig{KeyFile: s.keyFile, KnownHosts: s.knownHosts},
+		Client:  ClientOptions{DialTimeout: 2 * time.Second, DefaultTimeout: 5 * time.Second},
+	}
+	if err := cfg.Resolve(); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	return cfg
+}
+
+func get(t *testing.T, cfg *APIConfig, path string) (string, error) {
+	t.Helper()
+	resp, err := cfg.HTTPClient().Get(cfg.BaseURL + path)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestSSHRequestsShareOneConnection(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "")
+	resetSSHClients(t)
+	s := startSSHServer(t)
+	cfg := s.config(t, startUnixDaemon(t))
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := get(t, cfg, "/info")
+			if err != nil || body != "OK /v1.30/info" {
+				t.Errorf("GET /info = %q, %v", body, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := s.handshakes.Load(); n != 1 {
+		t.Errorf("%d SSH handshakes, want 1 shared connection", n)
+	}
+}
+
+// A socket that does not exist is an error for the call, not a reason to
+// close the connection other calls are streaming over.
+func TestSSHMissingSocketKeepsConnection(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "1.30")
+	resetSSHClients(t)
+	s := startSSHServer(t)
+	socket := startUnixDaemon(t)
+	good := s.config(t, socket)
+
+	target := &sshTarget{user: "deploy", addr: s.addr, socket: socket}
+	d := newSSHDialer(target, good.SSH, time.Second, nil)
+	stream, err := d.DialContext(context.Background(), "unix", "")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer stream.Close()
+
+	missing := &sshTarget{user: "deploy", addr: s.addr, socket: filepath.Join(filepath.Dir(socket), "missing.sock")}
+	_, err = newSSHDialer(missing, good.SSH, time.Second, nil).DialContext(context.Background(), "unix", "")
+	if err == nil || !strings.Contains(err.Error(), "missing.sock") {
+		t.Fatalf("dial of a missing socket: %v, want an error naming it", err)
+	}
+
+	// The stream opened before still works on the same connection.
+	io.WriteString(stream, "GET /_ping HTTP/1.0\r\n\r\n")
+	reply, err := io.ReadAll(stream)
+	if err != nil || !strings.Contains(string(reply), "OK /_ping") {
+		t.Errorf("stream after the failed dial: %q, %v", reply, err)
+	}
+	if n := s.handshakes.Load(); n != 1 {
+		t.Errorf("%d SSH handshakes, want the connection kept", n)
+	}
+}
+
+// A host that accepts TCP but never completes the handshake must not hold
+// up calls to other hosts.
+func TestSSHSlowHostDoesNotBlockOthers(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "1.30")
+	resetSSHClients(t)
+	s := startSSHServer(t)
+	good := s.config(t, startUnixDaemon(t))
+
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	var held sync.Mutex
+	var conns []net.Conn
+	defer func() {
+		held.Lock()
+		defer held.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+	go func() {
+		for {
+			c, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			held.Lock()
+			conns = append(conns, c)
+			held.Unlock()
+		}
+	}()
+	slow := newSSHDialer(&sshTarget{user: "deploy", addr: silent.Addr().String(), socket: defaultRemoteSocket}, good.SSH, 3*time.Second, nil)
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := slow.DialContext(context.Background(), "unix", "")
+		slowDone <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if body, err := get(t, good, "/_ping"); err != nil || !strings.HasPrefix(body, "OK") {
+		t.Fatalf("GET /_ping = %q, %v", body, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call to a healthy host took %s while another host was connecting", elapsed)
+	}
+	if err := <-slowDone; err == nil {
+		t.Error("the silent host was connected to")
+	}
+}
+
+func TestSSHUnknownHostKeyIsRejected(t *testing.T) {
+	resetSSHClients(t)
+	s := startSSHServer(t)
+	empty := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	target := &sshTarget{user: "deploy", addr: s.addr, socket: defaultRemoteSocket}
+	_, err := newSSHDialer(target, &SSHConfig{KeyFile: s.keyFile, KnownHosts: empty}, time.Second, nil).DialContext(context.Background(), "unix", "")
+	if err == nil || !strings.Contains(err.Error(), "key is unknown") {
+		t.Errorf("dial with an unknown host key: %v, want a host key error", err)
+	}
+}
+
+// A connection whose keepalive goes unanswered is dead, not waited on.
+func TestSSHKeepaliveTimeout(t *testing.T) {
+	resetSSHClients(t)
+	s := startSSHServer(t)
+	d := newSSHDialer(&sshTarget{user: "deploy", addr: s.addr, socket: defaultRemoteSocket}, &SSHConfig{KeyFile: s.keyFile, KnownHosts: s.knownHosts}, time.Second, nil)
+	client, err := d.client(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !client.alive() {
+		t.Fatal("a connection that answers keepalives is not alive")
+	}
+
+	timeout := keepaliveTimeout
+	keepaliveTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { keepaliveTimeout = timeout })
+	s.silent.Store(true)
+	start := time.Now()
+	if client.alive() {
+		t.Error("a connection that does not answer keepalives is alive")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("alive took %s", elapsed)
+	}
+}
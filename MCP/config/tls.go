@@ -0,0 +1,249 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TLSConfig holds the client-side TLS settings for the daemon connection.
+// It follows docker/tls.py: Verify enables server certificate verification
+// against CACert, and ClientCert/ClientKey are presented for mutual TLS.
+type TLSConfig struct {
+	Verify     bool
+	CACert     string
+	ClientCert string
+	ClientKey  string
+	// PEM material sent in request headers, used in place of the files.
+	CACertPEM     []byte
+	ClientCertPEM []byte
+	ClientKeyPEM  []byte
+}
+
+// lookupFunc reports the value of a setting and whether it was set at all.
+type lookupFunc func(key string) (string, bool)
+
+// loadTLSConfig reads DOCKER_TLS_VERIFY, DOCKER_CERT_PATH and the explicit
+// DOCKER_TLS_CACERT, DOCKER_TLS_CERT and DOCKER_TLS_KEY settings. It returns
+// nil when none of them enable TLS.
+func loadTLSConfig(lookup lookupFunc) (*TLSConfig, error) {
+	certPath, _ := lookup("DOCKER_CERT_PATH")
+	// An empty DOCKER_TLS_VERIFY counts as false, any other value as true.
+	verifyVal, _ := lookup("DOCKER_TLS_VERIFY")
+	verify := verifyVal != ""
+	caCert, _ := lookup("DOCKER_TLS_CACERT")
+	clientCert, _ := lookup("DOCKER_TLS_CERT")
+	clientKey, _ := lookup("DOCKER_TLS_KEY")
+
+	if certPath == "" && !verify && caCert == "" && clientCert == "" && clientKey == "" {
+		return nil, nil
+	}
+
+	if certPath == "" {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			certPath = filepath.Join(home, ".docker")
+		}
+	}
+	if certPath != "" {
+		caCert = defaultCertFile(caCert, certPath, "ca.pem")
+		clientCert = defaultCertFile(clientCert, certPath, "cert.pem")
+		clientKey = defaultCertFile(clientKey, certPath, "key.pem")
+	}
+
+	cfg := &TLSConfig{
+		Verify:     verify,
+		CACert:     caCert,
+		ClientCert: clientCert,
+		ClientKey:  clientKey,
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadHeaderTLSConfig reads the TLS headers of an HTTP-mode request. The
+// certificates and key are PEM content, base64 encoded or with "\n" escapes
+// for the line breaks; file paths are refused, and the server's own
+// certificates are never used for a daemon a client names. It returns nil
+// when the headers do not enable TLS.
+func loadHeaderTLSConfig(h http.Header) (*TLSConfig, error) {
+	if h.Get("DOCKER_CERT_PATH") != "" {
+		return nil, fmt.Errorf("DOCKER_CERT_PATH is not accepted in headers, send the PEM content in DOCKER_TLS_CACERT, DOCKER_TLS_CERT and DOCKER_TLS_KEY")
+	}
+	cfg := &TLSConfig{Verify: h.Get("DOCKER_TLS_VERIFY") != ""}
+	for _, field := range []struct {
+		header string
+		pem    *[]byte
+	}{
+		{"DOCKER_TLS_CACERT", &cfg.CACertPEM},
+		{"DOCKER_TLS_CERT", &cfg.ClientCertPEM},
+		{"DOCKER_TLS_KEY", &cfg.ClientKeyPEM},
+	} {
+		val := h.Get(field.header)
+		if val == "" {
+			continue
+		}
+		data, err := decodeHeaderPEM(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.header, err)
+		}
+		*field.pem = data
+	}
+	if !cfg.Verify && cfg.CACertPEM == nil && cfg.ClientCertPEM == nil && cfg.ClientKeyPEM == nil {
+		return nil, nil
+	}
+	if (cfg.ClientCertPEM == nil) != (cfg.ClientKeyPEM == nil) {
+		return nil, fmt.Errorf("TLS client certificate and key must be provided together (DOCKER_TLS_CERT, DOCKER_TLS_KEY)")
+	}
+	if cfg.CACertPEM != nil {
+		// A CA is only useful for verification, as with DOCKER_CERT_PATH.
+		cfg.Verify = true
+	}
+	if _, err := cfg.clientConfig(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decodeHeaderPEM accepts PEM content as is, with "\n" escapes, or base64
+// encoded.
+func decodeHeaderPEM(val string) ([]byte, error) {
+	if strings.HasPrefix(val, "-----BEGIN ") {
+		return []byte(strings.ReplaceAll(val, `\n`, "\n")), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(val)
+	if err != nil || !bytes.Contains(data, []byte("-----BEGIN ")) {
+		return nil, fmt.Errorf("expected PEM content, as is or base64 encoded")
+	}
+	return data, nil
+}
+
+// defaultCertFile returns explicit when set, otherwise name inside dir if that file exists.
+func defaultCertFile(explicit, dir, name string) string {
+	if explicit != "" {
+		return explicit
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+func (t *TLSConfig) validate() error {
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("TLS client certificate and key must be provided together (DOCKER_TLS_CERT, DOCKER_TLS_KEY)")
+	}
+	for _, f := range []string{t.CACert, t.ClientCert, t.ClientKey} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			return fmt.Errorf("TLS file %s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// clientConfig builds the crypto/tls configuration used to dial the daemon.
+func (t *TLSConfig) clientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Like docker-py, certificates are only checked when verification is
+		// requested; without CACert the system roots are used.
+		InsecureSkipVerify: !t.Verify,
+	}
+	if t.Verify && (t.CACert != "" || t.CACertPEM != nil) {
+		pem := t.CACertPEM
+		if pem == nil {
+			var err error
+			if pem, err = os.ReadFile(t.CACert); err != nil {
+				return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+			}
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA certificate %s contains no PEM certificates", t.caName())
+		}
+		cfg.RootCAs = pool
+	}
+	switch {
+	case t.ClientCertPEM != nil:
+		cert, err := tls.X509KeyPair(t.ClientCertPEM, t.ClientKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate from DOCKER_TLS_CERT with key from DOCKER_TLS_KEY: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	case t.ClientCert != "":
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate %s with key %s: %w", t.ClientCert, t.ClientKey, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// caName names the CA for error messages.
+func (t *TLSConfig) caName() string {
+	if t.CACertPEM != nil {
+		return "from DOCKER_TLS_CACERT"
+	}
+	return t.CACert
+}
+
+// tlsErrorTransport turns TLS handshake failures into errors that say which
+// side of the certificate setup does not match.
+type tlsErrorTransport struct {
+	next http.RoundTripper
+	tls  *TLSConfig
+}
+
+func (t *tlsErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, describeTLSError(err, t.tls)
+	}
+	return resp, nil
+}
+
+func describeTLSError(err error, cfg *TLSConfig) error {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+	switch {
+	case errors.As(err, &unknownAuthority):
+		ca := "the system roots"
+		if cfg != nil && (cfg.CACert != "" || cfg.CACertPEM != nil) {
+			ca = cfg.caName()
+		}
+		return fmt.Errorf("TLS error: daemon certificate is not signed by the CA in %s: %w", ca, err)
+	case errors.As(err, &hostname):
+		return fmt.Errorf("TLS error: daemon certificate is not valid for the configured host: %w", err)
+	case errors.As(err, &invalid):
+		return fmt.Errorf("TLS error: daemon certificate is invalid: %w", err)
+	case errors.As(err, &recordHeader):
+		return fmt.Errorf("TLS error: daemon did not answer with TLS; use tcp:// without DOCKER_TLS_VERIFY/DOCKER_CERT_PATH for a plain HTTP daemon: %w", err)
+	case strings.Contains(err.Error(), "remote error: tls:"):
+		switch {
+		case cfg != nil && cfg.ClientCertPEM != nil:
+			return fmt.Errorf("TLS error: daemon rejected the client certificate from DOCKER_TLS_CERT: %w", err)
+		case cfg == nil || cfg.ClientCert == "":
+			return fmt.Errorf("TLS error: daemon requires a client certificate; set DOCKER_CERT_PATH or DOCKER_TLS_CERT/DOCKER_TLS_KEY: %w", err)
+		}
+		return fmt.Errorf("TLS error: daemon rejected client certificate %s: %w", cfg.ClientCert, err)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertPEM returns a self-signed certificate and its key in PEM.
+func testCertPEM(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestLoadHeaderTLSConfig(t *testing.T) {
+	certPEM, keyPEM := testCertPEM(t)
+	escaped := strings.ReplaceAll(string(certPEM), "\n", `\n`)
+	encoded := base64.StdEncoding.EncodeToString(certPEM)
+	encodedKey := base64.StdEncoding.EncodeToString(keyPEM)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr string // Substring of the error, empty for success
+		wantTLS bool
+	}{
+		{"no TLS", nil, "", false},
+		{"verify only", map[string]string{"DOCKER_TLS_VERIFY": "1"}, "", true},
+		{"escaped CA", map[string]string{"DOCKER_TLS_CACERT": escaped}, "", true},
+		{"base64 CA and client pair", map[string]string{"DOCKER_TLS_CACERT": encoded, "DOCKER_TLS_CERT": encoded, "DOCKER_TLS_KEY": encodedKey}, "", true},
+		{"cert path", map[string]string{"DOCKER_CERT_PATH": "/root/.docker"}, "DOCKER_CERT_PATH is not accepted", false},
+		{"CA path", map[string]string{"DOCKER_TLS_CACERT": "/etc/docker/ca.pem"}, "DOCKER_TLS_CACERT: expected PEM content", false},
+		{"key path", map[string]string{"DOCKER_TLS_CERT": encoded, "DOCKER_TLS_KEY": "/root/.docker/key.pem"}, "DOCKER_TLS_KEY: expected PEM content", false},
+		{"cert without key", map[string]string{"DOCKER_TLS_CERT": encoded}, "must be provided together", false},
+		{"mismatched pair", map[string]string{"DOCKER_TLS_CERT": encoded, "DOCKER_TLS_KEY": encoded}, "failed to load TLS client certificate", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			cfg, err := loadHeaderTLSConfig(h)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (cfg != nil) != tt.wantTLS {
+				t.Fatalf("TLS config %+v, want TLS %t", cfg, tt.wantTLS)
+			}
+			if cfg != nil && (cfg.CACert != "" || cfg.ClientCert != "" || cfg.ClientKey != "") {
+				t.Errorf("header TLS config names files: %+v", cfg)
+			}
+		})
+	}
+}
+
+// A client enabling TLS must not be handed the server's own ~/.docker
+// certificates.
+func TestLoadHeaderConfigDoesNotUseServerCredentials(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dockerDir := filepath.Join(home, ".docker")
+	if err := os.MkdirAll(dockerDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM := testCertPEM(t)
+	os.WriteFile(filepath.Join(dockerDir, "cert.pem"), certPEM, 0o600)
+	os.WriteFile(filepath.Join(dockerDir, "key.pem"), keyPEM, 0o600)
+	t.Setenv("SSH_KEY_FILE", filepath.Join(home, ".ssh", "id_ed25519"))
+
+	h := http.Header{}
+	h.Set("API_BASE_URL", "tcp://127.0.0.1:2376")
+	h.Set("DOCKER_TLS_VERIFY", "1")
+	cfg, err := LoadHeaderConfig(h, nil)
+	if err != nil {
+		t.Fatalf("LoadHeaderConfig: %v", err)
+	}
+	if cfg.TLS == nil || cfg.TLS.ClientCert != "" || cfg.TLS.ClientCertPEM != nil {
+		t.Errorf("TLS config %+v, want verification without a client certificate", cfg.TLS)
+	}
+	if cfg.SSH != nil {
+		t.Errorf("header config carries the server's SSH settings: %+v", cfg.SSH)
+	}
+
+	h.Set("API_BASE_URL", "ssh://deploy@10.0.0.5")
+	if _, err := LoadHeaderConfig(h, nil); err == nil || !strings.Contains(err.Error(), "ssh://") {
+		t.Errorf("ssh:// header address: error %v, want a refusal", err)
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker-engine-api/mcp-server/models"
+)
+
+// LoadToolsets returns the toolsets named by TOOLSETS, rejecting names that
+// are not in models.Toolsets.
+func LoadToolsets() ([]string, error) {
+	return loadToolsets(lookupSetting)
+}
+
+func loadToolsets(lookup lookupFunc) ([]string, error) {
+	toolsets := settingList(lookup, "TOOLSETS")
+	for _, name := range toolsets {
+		if !slices.Contains(models.Toolsets, name) {
+			return nil, fmt.Errorf("TOOLSETS: unknown toolset %q, expected one of %s", name, strings.Join(models.Toolsets, ", "))
+		}
+	}
+	return toolsets, nil
+}
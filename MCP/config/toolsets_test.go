@@ -0,0 +1,47 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadToolsets(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    []string
+		wantErr string
+	}{
+		{val: "", want: nil},
+		{val: "containers, images,", want: []string{"containers", "images"}},
+		{val: "containers,volume", wantErr: `TOOLSETS: unknown toolset "volume"`},
+		{val: "Containers", wantErr: `unknown toolset "Containers"`},
+	}
+	for _, tt := range tests {
+		lookup := func(key string) (string, bool) {
+			if key != "TOOLSETS" {
+				t.Errorf("looked up %s", key)
+			}
+			return tt.val, tt.val != ""
+		}
+		got, err := loadToolsets(lookup)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadToolsets(%q) error %v, want %q", tt.val, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("loadToolsets(%q) = %v, %v; want %v", tt.val, got, err, tt.want)
+		}
+	}
+}
+
+// A reload is checked against TOOLSETS from the environment as well as the
+// file.
+func TestLoadReloadableChecksToolsets(t *testing.T) {
+	t.Setenv("TOOLSETS", "volume")
+	if _, err := LoadReloadable(&File{}); err == nil || !strings.Contains(err.Error(), `unknown toolset "volume"`) {
+		t.Errorf("LoadReloadable error %v, want an unknown toolset error", err)
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DefaultHost is the daemon address used by the Docker CLI when nothing else is configured.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// unixBaseURL is the placeholder URL used for requests over a unix socket.
+// The host part is never resolved; the transport dials the socket instead.
+const unixBaseURL = "http://localhost"
+
+// Resolve normalizes BaseURL into the HTTP URL tools build requests from and
+// prepares the HTTP client used to reach the daemon. BaseURL may be a
+// unix://, tcp://, ssh://, http:// or https:// address; the original value is
+// kept in Host.
+func (c *APIConfig) Resolve() error {
+	if c.Host == "" {
+		c.Host = c.BaseURL
+	}
+	baseURL, network, addr, err := parseHost(c.Host, c.TLS != nil)
+	if err != nil {
+		return err
+	}
+	if c.Client == (ClientOptions{}) {
+		c.Client = DefaultClientOptions()
+	}
+	transport, err := newTransport(c.Client)
+	if err != nil {
+		return err
+	}
+	switch network {
+	case "unix":
+		dialer := &net.Dialer{Timeout: c.Client.DialTimeout}
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", addr)
+		}
+	case "ssh":
+		u, _ := url.Parse(addr)
+		target, err := parseSSHHost(u)
+		if err != nil {
+			return fmt.Errorf("invalid daemon address %q: %w", RedactHost(addr), err)
+		}
+		dialer := newSSHDialer(target, c.SSH, c.Client.DialTimeout, c.dialControl)
+		transport.DialContext = dialer.DialContext
+		c.sshKey = dialer.key
+	default:
+		if c.dialControl != nil {
+			dialer := &net.Dialer{Timeout: c.Client.DialTimeout, KeepAlive: 30 * time.Second, Control: c.dialControl}
+			transport.DialContext = dialer.DialContext
+			// A proxy would be dialed instead of the daemon.
+			transport.Proxy = nil
+		}
+	}
+	if network != "" {
+		// Socket and SSH connections never go through an HTTP proxy.
+		transport.Proxy = nil
+	}
+	if c.TLS != nil && strings.HasPrefix(baseURL, "https://") {
+		tlsCfg, err := c.TLS.clientConfig()
+		if err != nil {
+			return err
+		}
+		if tlsCfg.RootCAs == nil && transport.TLSClientConfig != nil {
+			// No CA in the TLS settings: verify against the system roots plus CA_BUNDLE.
+			tlsCfg.RootCAs = transport.TLSClientConfig.RootCAs
+		}
+		transport.TLSClientConfig = tlsCfg
+	}
+	c.BaseURL = baseURL
+	// Credentials are applied below the version transport so the /_ping
+	// used for negotiation is authenticated too. The read-only guard sits
+	// below it as well, to check the final request paths.
+	authed := &authTransport{next: &tlsErrorTransport{next: transport, tls: c.TLS}, auths: c.authenticators()}
+	c.version = newVersionTransport(&readOnlyTransport{next: authed}, baseURL)
+	var rt http.RoundTripper = &observedTransport{next: c.version, cfg: c}
+	if wrap := transportMiddleware.Load(); wrap != nil {
+		rt = (*wrap)(c.Name, rt)
+	}
+	c.client = &http.Client{Transport: rt, CheckRedirect: noRedirects}
+	c.transport = transport
+	return nil
+}
+
+// sameSettings reports whether c and o were configured alike, so one can
+// stand in for the other.
+func (c *APIConfig) sameSettings(o *APIConfig) bool {
+	return c.Name == o.Name && c.Host == o.Host &&
+		c.BearerToken == o.BearerToken && c.APIKey == o.APIKey && c.BasicAuth == o.BasicAuth &&
+		reflect.DeepEqual(c.TLS, o.TLS) && reflect.DeepEqual(c.SSH, o.SSH) &&
+		c.Client == o.Client && c.AuthOptions == o.AuthOptions &&
+		len(c.Auth) == 0 && len(o.Auth) == 0
+}
+
+// errRedirect fails a request the daemon redirected. Following the redirect
+// would send the credentials, which are applied to every request the
+// transport carries, to whatever host the daemon (or a proxy in front of
+// it) names.
+var errRedirect = errors.New("the daemon answered with a redirect, which is not followed")
+
+func noRedirects(*http.Request, []*http.Request) error {
+	return errRedirect
+}
+
+// HTTPClient returns the client tools use to send requests to the daemon.
+func (c *APIConfig) HTTPClient() *http.Client {
+	if c.client == nil {
+		return http.DefaultClient
+	}
+	return c.client
+}
+
+// RedactHost returns a daemon address with any password in it masked, for
+// use in logs and error messages.
+func RedactHost(host string) string {
+	if u, err := url.Parse(host); err == nil {
+		return u.Redacted()
+	}
+	// Unparseable: drop everything between the scheme and the last '@'.
+	scheme, rest, ok := strings.Cut(host, "://")
+	if at := strings.LastIndex(rest, "@"); ok && at >= 0 {
+		return scheme + "://xxxxx@" + rest[at+1:]
+	}
+	return host
+}
+
+// parseHost splits a Docker host address into the base URL requests are sent
+// to and, for socket and SSH hosts, the network and address to dial. useTLS
+// selects https for tcp:// addresses.
+func parseHost(host string, useTLS bool) (baseURL, network, addr string, err error) {
+	if host == "" {
+		return "", "", "", fmt.Errorf("daemon address is empty")
+	}
+	shown := RedactHost(host)
+	u, err := url.Parse(host)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			// url.Error repeats the address, credentials included.
+			err = uerr.Err
+		}
+		return "", "", "", fmt.Errorf("invalid daemon address %q: %w", shown, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		if u.Host != "" {
+			// unix://relative/path.sock
+			path = u.Host + u.Path
+		}
+		if path == "" {
+			return "", "", "", fmt.Errorf("invalid daemon address %q: missing socket path", shown)
+		}
+		return unixBaseURL, "unix", path, nil
+	case "tcp":
+		if u.Host == "" {
+			return "", "", "", fmt.Errorf("invalid daemon address %q: missing host", shown)
+		}
+		scheme, port := "http", "2375"
+		if useTLS {
+			scheme, port = "https", "2376"
+		}
+		hostPort := u.Host
+		if u.Port() == "" {
+			hostPort = net.JoinHostPort(u.Hostname(), port)
+		}
+		return scheme + "://" + hostPort + strings.TrimSuffix(u.Path, "/"), "", "", nil
+	case "ssh":
+		if u.Host == "" {
+			return "", "", "", fmt.Errorf("invalid daemon address %q: missing host", shown)
+		}
+		// Requests are tunnelled to the remote unix socket, so they look like local socket requests.
+		return unixBaseURL, "ssh", host, nil
+	case "http", "https":
+		if u.Host == "" {
+			return "", "", "", fmt.Errorf("invalid daemon address %q: missing host", shown)
+		}
+		return strings.TrimSuffix(host, "/"), "", "", nil
+	default:
+		return "", "", "", fmt.Errorf("invalid daemon address %q: unsupported scheme %q (expected unix, tcp, ssh, http or https)", shown, u.Scheme)
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxAPIVersion is the Engine API version the tools are generated from.
+	MaxAPIVersion = "1.33"
+	// fallbackAPIVersion is assumed for daemons whose /_ping has no API-Version header.
+	fallbackAPIVersion = "1.24"
+	// negotiationTimeout bounds the /_ping that negotiates the version; it
+	// is shared by every call waiting for it, so no caller's deadline applies.
+	negotiationTimeout = 30 * time.Second
+)
+
+var versionPathRE = regexp.MustCompile(`/v[0-9]+\.[0-9]+$`)
+
+var versionRE = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// VersionLess reports whether Engine API version a is older than b.
+func VersionLess(a, b string) bool {
+	amaj, amin := splitVersion(a)
+	bmaj, bmin := splitVersion(b)
+	if amaj != bmaj {
+		return amaj < bmaj
+	}
+	return amin < bmin
+}
+
+func splitVersion(v string) (int, int) {
+	major, minor, _ := strings.Cut(strings.TrimPrefix(v, "v"), ".")
+	ma, _ := strconv.Atoi(major)
+	mi, _ := strconv.Atoi(minor)
+	return ma, mi
+}
+
+// versionTransport prefixes every request path with /vX.Y. The version is
+// negotiated on first use by pinging the daemon and taking the lower of its
+// API-Version and MaxAPIVersion, unless it was pinned up front.
+type versionTransport struct {
+	next      http.RoundTripper
+	baseURL   string
+	basePath  string
+	versioned bool // BaseURL already ends in /vX.Y
+
+	mu       sync.Mutex
+	version  string
+	inflight *negotiation // The ping in progress, shared by every caller
+}
+
+// negotiation is one /_ping; done is closed when version or err is set.
+type negotiation struct {
+	done    chan struct{}
+	version string
+	err     error
+}
+
+func newVersionTransport(next http.RoundTripper, baseURL string) *versionTransport {
+	t := &versionTransport{next: next, baseURL: baseURL}
+	if u, err := url.Parse(baseURL); err == nil {
+		t.basePath = u.Path
+	}
+	switch {
+	case versionPathRE.MatchString(t.basePath):
+		// The configured URL is already versioned; send paths unchanged.
+		t.version = strings.TrimPrefix(t.basePath[strings.LastIndex(t.basePath, "/"):], "/v")
+		t.versioned = true
+	default:
+		// An invalid DOCKER_API_VERSION fails LoadAPIConfig at startup; it is
+		// never put in a path, the version is negotiated instead.
+		if version, err := pinnedAPIVersion(lookupSetting); err == nil {
+			t.version = version
+		}
+	}
+	return t
+}
+
+// pinnedAPIVersion returns DOCKER_API_VERSION without its "v" prefix, "" when
+// it is not set, or an error when it is not a MAJOR.MINOR version.
+func pinnedAPIVersion(lookup lookupFunc) (string, error) {
+	val, _ := lookup("DOCKER_API_VERSION")
+	version := strings.TrimPrefix(val, "v")
+	if version != "" && !versionRE.MatchString(version) {
+		return "", fmt.Errorf("DOCKER_API_VERSION: invalid version %q, expected MAJOR.MINOR such as 1.41", val)
+	}
+	return version, nil
+}
+
+func (t *versionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	version, err := t.negotiate(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if t.versioned || !strings.HasPrefix(req.URL.Path, t.basePath) {
+		return t.next.RoundTrip(req)
+	}
+	prefixed := req.Clone(req.Context())
+	prefixed.URL.Path = t.basePath + "/v" + version + strings.TrimPrefix(req.URL.Path, t.basePath)
+	if req.URL.RawPath != "" {
+		prefixed.URL.RawPath = t.basePath + "/v" + version + strings.TrimPrefix(req.URL.RawPath, t.basePath)
+	}
+	return t.next.RoundTrip(prefixed)
+}
+
+// negotiate returns the API version to use, pinging the daemon the first
+// time. Callers arriving during the ping wait for it, or for ctx, without
+// holding the lock. Failed pings are not cached so a daemon that comes up
+// later is negotiated then.
+func (t *versionTransport) negotiate(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	if t.version != "" {
+		version := t.version
+		t.mu.Unlock()
+		return version, nil
+	}
+	n := t.inflight
+	if n == nil {
+		n = &negotiation{done: make(chan struct{})}
+		t.inflight = n
+		go t.ping(n)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-n.done:
+		return n.version, n.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("API version negotiation failed: %w", ctx.Err())
+	}
+}
+
+// ping negotiates the version for n and caches it when the daemon answered
+// with a 2xx status and a valid (or no) API-Version header.
+func (t *versionTransport) ping(n *negotiation) {
+	defer close(n.done)
+	n.version, n.err = t.pingVersion()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inflight = nil
+	if n.err == nil {
+		t.version = n.version
+	}
+}
+
+func (t *versionTransport) pingVersion() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), negotiationTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+"/_ping", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return "", fmt.Errorf("API version negotiation failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("API version negotiation failed: /_ping returned %s", resp.Status)
+	}
+
+	daemon := strings.TrimPrefix(resp.Header.Get("API-Version"), "v")
+	if daemon == "" {
+		daemon = fallbackAPIVersion
+	}
+	if !versionRE.MatchString(daemon) {
+		// The version ends up in every request path.
+		return "", fmt.Errorf("API version negotiation failed: invalid API-Version %q", daemon)
+	}
+	if VersionLess(daemon, MaxAPIVersion) {
+		return daemon, nil
+	}
+	return MaxAPIVersion, nil
+}
+
+// current returns the negotiated version without contacting the daemon.
+func (t *versionTransport) current() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.version
+}
+
+// APIVersion returns the Engine API version used with this daemon,
+// negotiating it first if needed.
+func (c *APIConfig) APIVersion(ctx context.Context) (string, error) {
+	if c.version == nil {
+		return "", fmt.Errorf("daemon address is not configured")
+	}
+	return c.version.negotiate(ctx)
+}
+
+// NegotiatedAPIVersion returns the API version if it is already known, or "".
+func (c *APIConfig) NegotiatedAPIVersion() string {
+	if c.version == nil {
+		return ""
+	}
+	return c.version.current()
+}
+
+// Ping checks that the daemon answers /_ping and returns the API version it
+// reports, which is empty for daemons that do not send one.
+func (c *APIConfig) Ping(ctx context.Context) (string, error) {
+	if c.version == nil {
+		return "", fmt.Errorf("daemon address is not configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/_ping", nil)
+	if err != nil {
+		return "", err
+	}
+	// Below the version transport: the ping needs no version prefix and must
+	// not wait for negotiation.
+	resp, err := c.version.next.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("/_ping returned %s", resp.Status)
+	}
+	return resp.Header.Get("API-Version"), nil
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNegotiateCachesOnlySuccessfulPings(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "")
+	var status atomic.Int32
+	status.Store(http.StatusUnauthorized)
+	var pings atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+		w.Header().Set("API-Version", "1.30")
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+	vt := newVersionTransport(http.DefaultTransport, srv.URL)
+
+	for _, code := range []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError} {
+		status.Store(int32(code))
+		if v, err := vt.negotiate(context.Background()); err == nil {
+			t.Errorf("status %d: negotiated %q, want an error", code, v)
+		}
+		if v := vt.current(); v != "" {
+			t.Fatalf("status %d: cached version %q", code, v)
+		}
+	}
+	status.Store(http.StatusOK)
+	for range 2 {
+		if v, err := vt.negotiate(context.Background()); err != nil || v != "1.30" {
+			t.Fatalf("negotiate = %q, %v; want 1.30", v, err)
+		}
+	}
+	if n := pings.Load(); n != 4 {
+		t.Errorf("%d pings, want 4 (the version is cached after the first success)", n)
+	}
+}
+
+func TestNegotiateVersionHeader(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "")
+	tests := []struct {
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{"", fallbackAPIVersion, false},
+		{"1.25", "1.25", false},
+		{"1.47", MaxAPIVersion, false},
+		{"1.30/../../containers", "", true},
+		{"latest", "", true},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.header != "" {
+				w.Header().Set("API-Version", tt.header)
+			}
+		}))
+		v, err := newVersionTransport(http.DefaultTransport, srv.URL).negotiate(context.Background())
+		srv.Close()
+		if (err != nil) != tt.wantErr || v != tt.want {
+			t.Errorf("API-Version %q: negotiated %q, %v; want %q (error %t)", tt.header, v, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// A ping that hangs must not hold up callers whose context ends, and every
+// caller shares the one ping.
+func TestNegotiateDoesNotBlockOnHungPing(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "")
+	release := make(chan struct{})
+	var pings atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+		<-release
+		w.Header().Set("API-Version", "1.29")
+	}))
+	defer srv.Close()
+	defer close(release)
+	vt := newVersionTransport(http.DefaultTransport, srv.URL)
+
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		_, err := vt.negotiate(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("negotiate error %v, want the caller's deadline", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("negotiate returned after %s", elapsed)
+		}
+	}
+	if n := pings.Load(); n != 1 {
+		t.Errorf("%d pings in flight, want 1 shared ping", n)
+	}
+}
+
+// DOCKER_API_VERSION ends up in every request path, so only MAJOR.MINOR
+// versions are used; anything else fails at startup and is never sent.
+func TestPinnedAPIVersion(t *testing.T) {
+	t.Setenv("API_BASE_URL", "")
+	t.Setenv("DOCKER_ENDPOINTS", "")
+	var path atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path.Store(r.URL.Path)
+		w.Header().Set("API-Version", "1.29")
+	}))
+	defer srv.Close()
+	t.Setenv("DOCKER_HOST", srv.URL)
+
+	tests := []struct {
+		val      string
+		wantPath string // Path of GET /info, empty when startup fails
+	}{
+		{"", "/v1.29/info"},
+		{"1.25", "/v1.25/info"},
+		{"v1.25", "/v1.25/info"},
+		{"1.25/../../containers", ""},
+		{"latest", ""},
+		{"1", ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("DOCKER_API_VERSION", tt.val)
+		cfg, err := LoadAPIConfig()
+		if tt.wantPath == "" {
+			if err == nil || !strings.Contains(err.Error(), "DOCKER_API_VERSION: invalid version") {
+				t.Errorf("DOCKER_API_VERSION=%q: %v, want an invalid version error", tt.val, err)
+			}
+			// Configurations built without LoadAPIConfig negotiate instead.
+			cfg = &APIConfig{BaseURL: srv.URL}
+			if err := cfg.Resolve(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := get(t, cfg, "/info"); err != nil {
+				t.Fatal(err)
+			}
+			if got := path.Load(); got != "/v1.29/info" {
+				t.Errorf("DOCKER_API_VERSION=%q: request sent to %v, want the negotiated version", tt.val, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("DOCKER_API_VERSION=%q: %v", tt.val, err)
+		}
+		if _, err := get(t, cfg, "/info"); err != nil {
+			t.Fatal(err)
+		}
+		if got := path.Load(); got != tt.wantPath {
+			t.Errorf("DOCKER_API_VERSION=%q: request sent to %v, want %s", tt.val, got, tt.wantPath)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/docker-engine-api/mcp-server/audit"
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// preview is the result of a destructive tool called without confirm: true.
+type preview struct {
+	Preview   bool     `json:"preview"`
+	Tool      string   `json:"tool"`
+	Message   string   `json:"message"`
+	Affected  []any    `json:"affected"`
+	TotalSize *int64   `json:"total_size_bytes,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// previewer gathers what a destructive call with args would affect, using
+// read-only requests only.
+type previewer func(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error
+
+// withConfirm applies the mode DESTRUCTIVE_MODE and DESTRUCTIVE_TOOLS set for
+// each destructive tool. In preview mode the tool gains a "confirm" argument;
+// calls without confirm: true change nothing and return what the call would
+// affect.
+func withConfirm(cfg *config.APIConfig, modes config.ConfirmModes) toolMiddleware {
+	return func(tool models.Tool) models.Tool {
+		if !tool.Destructive {
+			return tool
+		}
+		name := tool.Definition.Name
+		switch modes.For(name) {
+		case config.ConfirmAllow:
+			return tool
+		case config.ConfirmDeny:
+			tool.Definition.Description += " (disabled on this server)"
+			tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				log.Printf("Refused %s: destructive tool denied on this server%s", name, clientSuffix(ctx))
+				return mcp.NewToolResultError(fmt.Sprintf("%s is disabled on this server", name)), nil
+			}
+			return tool
+		}
+
+		mcp.WithBoolean("confirm", mcp.Description("Set to true to perform the operation. Without it nothing is changed and a preview of what would be affected is returned"))(&tool.Definition)
+		next := tool.Handler
+		previewFn := previewers[name]
+		tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			val, _ := takeArg(&request, "confirm")
+			if confirmed, _ := val.(bool); confirmed {
+				return next(ctx, request)
+			}
+			audit.MarkPreview(ctx)
+			p := &preview{
+				Preview:  true,
+				Tool:     name,
+				Message:  "Nothing was changed. Call again with confirm: true to perform the operation.",
+				Affected: []any{},
+			}
+			if previewFn != nil {
+				args, _ := request.Params.Arguments.(map[string]any)
+				if err := previewFn(ctx, config.FromContext(ctx, cfg), args, p); err != nil {
+					return mcp.NewToolResultErrorFromErr("Preview failed", err), nil
+				}
+			}
+			data, err := json.MarshalIndent(p, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultErrorFromErr("Failed to format JSON", err), nil
+			}
+			return mcp.NewToolResultText(string(data)), nil
+		}
+		return tool
+	}
+}
+
+// daemonGet sends a GET request for path to the daemon and decodes the JSON
+// response into out.
+func daemonGet(ctx context.Context, cfg *config.APIConfig, path string, query url.Values, out any) error {
+	target := cfg.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := cfg.HTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("API error: %s", body)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// pruneFilters decodes the "filters" argument of the prune tools, a JSON
+// map of either lists or sets of values, into lists.
+func pruneFilters(args map[string]any) (map[string][]string, error) {
+	filters := map[string][]string{}
+	val, ok := args["filters"].(string)
+	if !ok || val == "" {
+		return filters, nil
+	}
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(val), &raw); err != nil {
+		return nil, fmt.Errorf("invalid filters: %w", err)
+	}
+	for key, values := range raw {
+		switch values := values.(type) {
+		case []any:
+			for _, v := range values {
+				filters[key] = append(filters[key], fmt.Sprint(v))
+			}
+		case map[string]any:
+			for v, set := range values {
+				if set == true {
+					filters[key] = append(filters[key], v)
+				}
+			}
+		default:
+			filters[key] = append(filters[key], fmt.Sprint(values))
+		}
+	}
+	return filters, nil
+}
+
+// filterQuery encodes filters as the "filters" query parameter.
+func filterQuery(filters map[string][]string) url.Values {
+	query := url.Values{}
+	if len(filters) > 0 {
+		data, _ := json.Marshal(filters)
+		query.Set("filters", string(data))
+	}
+	return query
+}
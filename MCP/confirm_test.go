@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const anonymousVolume = "4f3c2b1a4f3c2b1a4f3c2b1a4f3c2b1a4f3c2b1a4f3c2b1a4f3c2b1a4f3c2b1a"
+
+// previewDaemon serves the inspect of one running container with a named
+// and an anonymous volume, and answers 404 for any other container.
+func previewDaemon(t *testing.T) *config.APIConfig {
+	t.Helper()
+	t.Setenv("DOCKER_API_VERSION", "1.41")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("preview sent %s %s", r.Method, r.URL.Path)
+		}
+		if r.URL.Path != "/v1.41/containers/web/json" {
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{
+			"Id": "0123456789abcdef0123",
+			"Name": "/web",
+			"Config": {"Image": "nginx"},
+			"State": {"Status": "running", "Running": true},
+			"Mounts": [
+				{"Type": "volume", "Name": "pgdata", "Source": "/var/lib/docker/volumes/pgdata/_data", "Destination": "/data"},
+				{"Type": "volume", "Name": "` + anonymousVolume + `", "Source": "/var/lib/docker/volumes/x/_data", "Destination": "/cache"},
+				{"Type": "bind", "Source": "/srv/conf", "Destination": "/etc/nginx"}
+			]
+		}`))
+	}))
+	t.Cleanup(srv.Close)
+	cfg := &config.APIConfig{BaseURL: srv.URL}
+	if err := cfg.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// deleteTool stands in for delete_containers_id and records the arguments
+// of the calls that reach it.
+func deleteTool(calls *[]map[string]any) models.Tool {
+	return models.Tool{
+		Definition:  mcp.NewTool("delete_containers_id", mcp.WithString("id")),
+		Destructive: true,
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			*calls = append(*calls, request.GetArguments())
+			return mcp.NewToolResultText("deleted"), nil
+		},
+	}
+}
+
+func callWith(t *testing.T, tool models.Tool, args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = args
+	result, err := tool.Handler(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestWithConfirmPreview(t *testing.T) {
+	cfg := previewDaemon(t)
+	var calls []map[string]any
+	tool := withConfirm(cfg, config.ConfirmModes{Default: config.ConfirmPreview})(deleteTool(&calls))
+	if _, ok := tool.Definition.InputSchema.Properties["confirm"]; !ok {
+		t.Error("the tool has no confirm argument in preview mode")
+	}
+
+	for _, confirm := range []any{nil, false, "true"} {
+		args := map[string]any{"id": "web", "v": true}
+		if confirm != nil {
+			args["confirm"] = confirm
+		}
+		result := callWith(t, tool, args)
+		var p preview
+		if err := json.Unmarshal([]byte(resultText(result)), &p); err != nil {
+			t.Fatalf("confirm %v: %s: %v", confirm, resultText(result), err)
+		}
+		if !p.Preview || p.Tool != "delete_containers_id" || len(p.Affected) != 1 {
+			t.Errorf("confirm %v: preview %+v", confirm, p)
+		}
+		want := []string{
+			"the container is running; removing it fails unless force is true",
+			"v is true: anonymous volume " + anonymousVolume + " mounted at /cache is removed too",
+		}
+		if !reflect.DeepEqual(p.Warnings, want) {
+			t.Errorf("confirm %v: warnings %q, want %q", confirm, p.Warnings, want)
+		}
+	}
+	if len(calls) != 0 {
+		t.Fatalf("previews reached the tool: %v", calls)
+	}
+
+	if text := resultText(callWith(t, tool, map[string]any{"id": "web", "confirm": true})); text != "deleted" {
+		t.Errorf("confirmed call: %s", text)
+	}
+	if len(calls) != 1 || !reflect.DeepEqual(calls[0], map[string]any{"id": "web"}) {
+		t.Errorf("the confirmed call reached the tool with %v, want confirm removed", calls)
+	}
+
+	result := callWith(t, tool, map[string]any{"id": "gone"})
+	if !result.IsError || !strings.Contains(resultText(result), "Preview failed") || !strings.Contains(resultText(result), "No such container") {
+		t.Errorf("preview of a missing container: %s", resultText(result))
+	}
+}
+
+func TestWithConfirmModes(t *testing.T) {
+	var calls []map[string]any
+	modes := config.ConfirmModes{Default: config.ConfirmPreview, Rules: []config.ConfirmRule{{Pattern: "delete_*", Mode: config.ConfirmAllow}, {Pattern: "delete_containers_id", Mode: config.ConfirmDeny}}}
+
+	denied := withConfirm(nil, modes)(deleteTool(&calls))
+	result := callWith(t, denied, map[string]any{"id": "web", "confirm": true})
+	if !result.IsError || resultText(result) != "delete_containers_id is disabled on this server" {
+		t.Errorf("denied tool: %s", resultText(result))
+	}
+	if !strings.HasSuffix(denied.Definition.Description, "(disabled on this server)") {
+		t.Errorf("denied tool description %q", denied.Definition.Description)
+	}
+	if len(calls) != 0 {
+		t.Errorf("a denied call reached the tool")
+	}
+
+	allowed := deleteTool(&calls)
+	allowed.Definition.Name = "delete_images_name"
+	allowed = withConfirm(nil, modes)(allowed)
+	if _, ok := allowed.Definition.InputSchema.Properties["confirm"]; ok {
+		t.Error("an allowed tool has a confirm argument")
+	}
+	if text := resultText(callWith(t, allowed, map[string]any{"id": "web"})); text != "deleted" || len(calls) != 1 {
+		t.Errorf("allowed tool: %s", text)
+	}
+
+	// Tools that are not destructive are never wrapped.
+	safe := deleteTool(&calls)
+	safe.Destructive = false
+	safe = withConfirm(nil, config.ConfirmModes{Default: config.ConfirmDeny})(safe)
+	if text := resultText(callWith(t, safe, map[string]any{"id": "web"})); text != "deleted" {
+		t.Errorf("non-destructive tool: %s", text)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultDrainTimeout is how long running tool calls may take to finish after
+// a shutdown signal, unless DRAIN_TIMEOUT says otherwise.
+const defaultDrainTimeout = 15 * time.Second
+
+// cancelGrace is how long cancelled calls get to return their result.
+const cancelGrace = 2 * time.Second
+
+var errShuttingDown = errors.New("server shutting down")
+
+// drainer lets running tool calls finish when the server shuts down. Once
+// draining, new calls are refused, streaming calls are closed at once and the
+// others are cancelled if they outlast the drain period.
+type drainer struct {
+	mu       sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+	running  atomic.Int64
+
+	streams, all         context.Context
+	stopStreams, stopAll context.CancelCauseFunc
+}
+
+func newDrainer() *drainer {
+	d := &drainer{}
+	d.all, d.stopAll = context.WithCancelCause(context.Background())
+	d.streams, d.stopStreams = context.WithCancelCause(d.all)
+	return d
+}
+
+// drain is the drainer of every tool; it also tells /readyz to report the
+// instance as not ready while it shuts down.
+var drain = newDrainer()
+
+// isDraining reports whether shutdown has started.
+func (d *drainer) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// middleware refuses calls after shutdown started and ends running calls
+// with a "server shutting down" result when they are cancelled by it.
+func (d *drainer) middleware(tool models.Tool) models.Tool {
+	stop := d.all
+	if tool.Streaming {
+		stop = d.streams
+	}
+	next := tool.Handler
+	tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		d.mu.Lock()
+		if d.draining {
+			d.mu.Unlock()
+			return mcp.NewToolResultError("Server shutting down: not accepting new tool calls"), nil
+		}
+		d.wg.Add(1)
+		d.mu.Unlock()
+		d.running.Add(1)
+		defer func() {
+			d.running.Add(-1)
+			d.wg.Done()
+		}()
+
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		defer context.AfterFunc(stop, func() { cancel(errShuttingDown) })()
+
+		result, err := next(ctx, request)
+		if errors.Is(context.Cause(ctx), errShuttingDown) {
+			return cancelledResult(fmt.Sprintf("Server shutting down: %s was cancelled", tool.Definition.Name)), nil
+		}
+		return result, err
+	}
+	return tool
+}
+
+// drain refuses new calls, closes streaming calls and waits up to period for
+// the others before cancelling them too.
+func (d *drainer) drain(period time.Duration) {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+	d.stopStreams(errShuttingDown)
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	if n := d.running.Load(); n > 0 {
+		log.Printf("Draining %d tool calls for up to %s", n, period)
+	}
+	select {
+	case <-done:
+		return
+	case <-time.After(period):
+	}
+	log.Printf("Drain period over, cancelling %d tool calls", d.running.Load())
+	d.stopAll(errShuttingDown)
+	select {
+	case <-done:
+	case <-time.After(cancelGrace):
+		log.Printf("%d tool calls did not return after cancellation", d.running.Load())
+	}
+}
+
+// abort refuses new calls and cancels every running one, for when the
+// client is gone and nobody is waiting for the results.
+func (d *drainer) abort() {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+	d.stopAll(errShuttingDown)
+}
+
+// eofReader calls onEOF once the underlying reader is exhausted, so STDIO
+// mode notices a disconnected client while calls are still running.
+type eofReader struct {
+	r     io.Reader
+	once  sync.Once
+	onEOF func()
+}
+
+func (e *eofReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil {
+		e.once.Do(e.onEOF)
+	}
+	return n, err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// blockingTool returns a tool that signals started when called and then
+// waits for release, or for its context to end.
+func blockingTool(name string, streaming bool, started chan<- struct{}, release <-chan struct{}) models.Tool {
+	return models.Tool{
+		Definition:  mcp.NewTool(name),
+		LongRunning: true,
+		Streaming:   streaming,
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			started <- struct{}{}
+			select {
+			case <-release:
+				return mcp.NewToolResultText("finished"), nil
+			case <-ctx.Done():
+				return mcp.NewToolResultError("API error: " + ctx.Err().Error()), nil
+			}
+		},
+	}
+}
+
+type callResult struct {
+	text    string
+	isError bool
+}
+
+// startCall runs tool in the background and returns its result channel once
+// the handler is running.
+func startCall(t *testing.T, tool models.Tool, started <-chan struct{}) <-chan callResult {
+	t.Helper()
+	results := make(chan callResult, 1)
+	go func() {
+		result, err := tool.Handler(context.Background(), mcp.CallToolRequest{})
+		if err != nil {
+			results <- callResult{text: err.Error(), isError: true}
+			return
+		}
+		results <- callResult{text: resultText(result), isError: result.IsError}
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s did not start", tool.Definition.Name)
+	}
+	return results
+}
+
+func waitResult(t *testing.T, results <-chan callResult) callResult {
+	t.Helper()
+	select {
+	case r := <-results:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("the call did not return")
+		return callResult{}
+	}
+}
+
+// Draining closes streams at once, refuses new calls and lets the other
+// calls, long-running ones included, finish within the drain period.
+func TestDrainLetsCallsFinish(t *testing.T) {
+	d := newDrainer()
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	commit := d.middleware(blockingTool("post_commit", false, started, release))
+	logs := d.middleware(blockingTool("get_containers_id_logs", true, started, release))
+
+	commitResult := startCall(t, commit, started)
+	logsResult := startCall(t, logs, started)
+
+	drained := make(chan struct{})
+	go func() {
+		d.drain(5 * time.Second)
+		close(drained)
+	}()
+
+	r := waitResult(t, logsResult)
+	if !r.isError || r.text != "Server shutting down: get_containers_id_logs was cancelled" {
+		t.Errorf("streaming call: %+v, want it closed by the shutdown", r)
+	}
+	for !d.isDraining() {
+		time.Sleep(time.Millisecond)
+	}
+	refused, err := commit.Handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil || !refused.IsError || !strings.Contains(resultText(refused), "not accepting new tool calls") {
+		t.Errorf("call while draining: %v, %v; want it refused", refused, err)
+	}
+
+	select {
+	case r := <-commitResult:
+		t.Fatalf("long-running call ended when the drain started: %+v", r)
+	case <-drained:
+		t.Fatal("drain returned while a call was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if r := waitResult(t, commitResult); r.isError || r.text != "finished" {
+		t.Errorf("in-flight call: %+v, want its own result", r)
+	}
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not return after the last call finished")
+	}
+}
+
+func TestDrainCancelsCallsAfterPeriod(t *testing.T) {
+	d := newDrainer()
+	started := make(chan struct{}, 1)
+	tool := d.middleware(blockingTool("post_swarm_init", false, started, nil))
+	results := startCall(t, tool, started)
+
+	start := time.Now()
+	d.drain(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > cancelGrace {
+		t.Errorf("drain took %s", elapsed)
+	}
+	r := waitResult(t, results)
+	if !r.isError || r.text != "Server shutting down: post_swarm_init was cancelled" {
+		t.Errorf("call outlasting the drain period: %+v", r)
+	}
+}
+
+// A closed stdin cancels the running calls, so Listen returns and the
+// process exits instead of waiting for streams nobody reads.
+func TestStdioDisconnectAbortsCalls(t *testing.T) {
+	d := newDrainer()
+	started := make(chan struct{}, 1)
+	events := d.middleware(blockingTool("get_events", true, started, nil))
+	commit := d.middleware(blockingTool("post_commit", false, started, nil))
+	mcpSrv := server.NewMCPServer("test", "1.0", server.WithToolCapabilities(true))
+	for _, tool := range []models.Tool{events, commit} {
+		mcpSrv.AddTool(tool.Definition, tool.Handler)
+	}
+
+	stdin, input := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.NewStdioServer(mcpSrv).Listen(context.Background(), &eofReader{r: stdin, onEOF: d.abort}, io.Discard)
+	}()
+	io.WriteString(input, initializeRequest+"\n")
+	for i, name := range []string{"get_events", "post_commit"} {
+		fmt.Fprintf(input, `{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":%q}}`+"\n", i+2, name)
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s did not start", name)
+		}
+	}
+	input.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen did not return after stdin closed")
+	}
+	if !d.isDraining() {
+		t.Error("calls are still accepted after the client disconnected")
+	}
+}
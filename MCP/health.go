@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/config"
+)
+
+// defaultReadyTimeout bounds each daemon ping made by /readyz.
+const defaultReadyTimeout = 2 * time.Second
+
+// endpointHealth is one daemon in the /readyz response.
+type endpointHealth struct {
+	Name          string  `json:"name"`
+	Required      bool    `json:"required"`
+	Ready         bool    `json:"ready"`
+	APIVersion    string  `json:"api_version,omitempty"`
+	LatencyMillis float64 `json:"latency_ms,omitempty"`
+	Error         string  `json:"error,omitempty"` // "timed out" or "unreachable"; the details are logged
+}
+
+// readiness is the /readyz response.
+type readiness struct {
+	Status    string           `json:"status"` // "ready", "not ready" or "shutting down"
+	Endpoints []endpointHealth `json:"endpoints"`
+}
+
+// checkReadiness pings every daemon configured on the server. The server is
+// ready when all required ones answer: those in READY_REQUIRED_ENDPOINTS, or
+// all of them when it is not set. Sessions that bring their own daemon in
+// headers have nothing to check here.
+func checkReadiness(ctx context.Context, daemons config.Endpoints) readiness {
+	timeout := defaultReadyTimeout
+	if val := config.Setting("READY_TIMEOUT"); val != "" {
+		if d, err := config.ParseDuration(val); err == nil && d > 0 {
+			timeout = d
+		} else {
+			log.Printf("Invalid READY_TIMEOUT %q, using %s", val, defaultReadyTimeout)
+		}
+	}
+	required := config.SettingList("READY_REQUIRED_ENDPOINTS")
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result := readiness{Status: "ready", Endpoints: make([]endpointHealth, len(daemons))}
+	var wg sync.WaitGroup
+	for i, ep := range daemons {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health := endpointHealth{Name: ep.Name, Required: len(required) == 0 || slices.Contains(required, ep.Name)}
+			start := time.Now()
+			version, err := ep.Config.Ping(ctx)
+			if err != nil {
+				// /readyz is not authenticated: daemon addresses and errors
+				// stay in the log.
+				log.Printf("Readiness check of endpoint %s failed: %v", ep.Name, err)
+				health.Error = "unreachable"
+				if errors.Is(err, context.DeadlineExceeded) {
+					health.Error = "timed out"
+				}
+			} else {
+				health.Ready = true
+				health.APIVersion = version
+				health.LatencyMillis = float64(time.Since(start).Microseconds()) / 1000
+			}
+			result.Endpoints[i] = health
+		}()
+	}
+	wg.Wait()
+	for _, health := range result.Endpoints {
+		if health.Required && !health.Ready {
+			result.Status = "not ready"
+		}
+	}
+	return result
+}
+
+// readyzHandler serves /readyz, answering 503 while a required daemon is down
+// or the server is shutting down, so orchestrators stop routing clients to
+// this instance.
+func readyzHandler(tools *toolSet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := checkReadiness(r.Context(), tools.daemons())
+		if drain.isDraining() {
+			result.Status = "shutting down"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if result.Status != "ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// healthzHandler serves /healthz, which only reports that the process is up.
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// limitsHandler serves /limits, the current state of the rate limits.
+func limitsHandler(tools *toolSet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tools.rateLimits())
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/config"
+)
+
+// healthEndpoint returns an endpoint for a daemon that answers /_ping with
+// API version 1.41 after delay.
+func healthEndpoint(t *testing.T, name string, delay time.Duration) config.Endpoint {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("API-Version", "1.41")
+		w.Write([]byte("OK"))
+	}))
+	t.Cleanup(srv.Close)
+	return resolvedEndpoint(t, name, srv.URL)
+}
+
+func resolvedEndpoint(t *testing.T, name, address string) config.Endpoint {
+	t.Helper()
+	cfg := &config.APIConfig{Name: name, BaseURL: address}
+	if err := cfg.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	return config.Endpoint{Name: name, Address: address, Config: cfg}
+}
+
+// downEndpoint returns an endpoint whose address refuses connections.
+func downEndpoint(t *testing.T, name string) config.Endpoint {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := "http://" + l.Addr().String()
+	l.Close()
+	return resolvedEndpoint(t, name, address)
+}
+
+func getReadyz(t *testing.T, endpoints config.Endpoints) (int, string, readiness) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	readyzHandler(&toolSet{endpoints: endpoints}).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	var result readiness
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("/readyz body %s: %v", w.Body, err)
+	}
+	return w.Code, w.Body.String(), result
+}
+
+// endpointErrors returns the error of each endpoint, "" for those that are ready.
+func endpointErrors(result readiness) map[string]string {
+	errs := map[string]string{}
+	for _, ep := range result.Endpoints {
+		errs[ep.Name] = ep.Error
+	}
+	return errs
+}
+
+func TestReadyz(t *testing.T) {
+	t.Setenv("READY_REQUIRED_ENDPOINTS", "")
+	t.Setenv("READY_TIMEOUT", "200ms")
+	up := healthEndpoint(t, "up", 0)
+	slow := healthEndpoint(t, "slow", 5*time.Second)
+	down := downEndpoint(t, "down")
+
+	code, _, result := getReadyz(t, config.Endpoints{up})
+	if code != http.StatusOK || result.Status != "ready" || !result.Endpoints[0].Ready || result.Endpoints[0].APIVersion != "1.41" {
+		t.Errorf("one daemon up: %d %+v", code, result)
+	}
+
+	code, body, result := getReadyz(t, config.Endpoints{up, slow, down})
+	if code != http.StatusServiceUnavailable || result.Status != "not ready" {
+		t.Errorf("daemons down: %d %+v", code, result)
+	}
+	want := map[string]string{"up": "", "slow": "timed out", "down": "unreachable"}
+	if got := endpointErrors(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("errors %v, want %v", got, want)
+	}
+	// The unauthenticated probe does not show daemon addresses or errors.
+	for _, leak := range []string{strings.TrimPrefix(down.Address, "http://"), "connection refused", "dial"} {
+		if strings.Contains(body, leak) {
+			t.Errorf("/readyz shows %q: %s", leak, body)
+		}
+	}
+
+	// Only the required endpoints decide readiness.
+	t.Setenv("READY_REQUIRED_ENDPOINTS", "up")
+	code, _, result = getReadyz(t, config.Endpoints{up, down})
+	if code != http.StatusOK || result.Status != "ready" || result.Endpoints[1].Required || result.Endpoints[1].Ready {
+		t.Errorf("optional daemon down: %d %+v", code, result)
+	}
+	t.Setenv("READY_REQUIRED_ENDPOINTS", "down")
+	if code, _, _ := getReadyz(t, config.Endpoints{up, down}); code != http.StatusServiceUnavailable {
+		t.Errorf("required daemon down: %d", code)
+	}
+}
+
+func TestReadyzDraining(t *testing.T) {
+	t.Setenv("READY_REQUIRED_ENDPOINTS", "")
+	drain.mu.Lock()
+	drain.draining = true
+	drain.mu.Unlock()
+	t.Cleanup(func() {
+		drain.mu.Lock()
+		drain.draining = false
+		drain.mu.Unlock()
+	})
+	code, _, result := getReadyz(t, config.Endpoints{healthEndpoint(t, "up", 0)})
+	if code != http.StatusServiceUnavailable || result.Status != "shutting down" {
+		t.Errorf("draining: %d %+v", code, result)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// withHost adds the optional "host" argument, which routes a call to one of
+// the named endpoints. Fan-out tools also accept "*" to query all of them.
+// With a daemon allowlist only the endpoints it names can be chosen.
+func withHost(all config.Endpoints, allow *config.DaemonAllowlist) toolMiddleware {
+	endpoints := allowedEndpoints(all, allow)
+	return func(tool models.Tool) models.Tool {
+		if len(endpoints) == 0 {
+			return tool
+		}
+		names := endpoints.Names()
+		desc := "Named endpoint to send this call to instead of the default daemon"
+		if tool.FanOut {
+			names = append(names, config.FanOutHost)
+			desc += `; "*" queries every endpoint and merges the results`
+		}
+		mcp.WithString("host", mcp.Description(desc), mcp.Enum(names...))(&tool.Definition)
+		next := tool.Handler
+		tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			val, ok := takeArg(&request, "host")
+			if !ok {
+				return next(ctx, request)
+			}
+			name, ok := val.(string)
+			if !ok {
+				return mcp.NewToolResultError("Invalid parameter: host"), nil
+			}
+			switch {
+			case name == "":
+				return next(ctx, request)
+			case name == config.FanOutHost && tool.FanOut:
+				return fanOut(ctx, endpoints, next, request), nil
+			case name == config.FanOutHost:
+				return mcp.NewToolResultError(fmt.Sprintf(`host "*" is only supported by list tools, not %s`, tool.Definition.Name)), nil
+			}
+			ep, ok := endpoints.Lookup(name)
+			if _, exists := all.Lookup(name); !ok && exists {
+				log.Printf("Refused %s: host %s is not in ALLOWED_DAEMONS%s", tool.Definition.Name, name, clientSuffix(ctx))
+				return mcp.NewToolResultError(fmt.Sprintf("Host %q is not allowed on this server", name)), nil
+			}
+			if !ok {
+				return mcp.NewToolResultError(fmt.Sprintf("Unknown host %q, use list_hosts to see the configured endpoints", name)), nil
+			}
+			return next(config.NewContext(ctx, ep.Config), request)
+		}
+		return tool
+	}
+}
+
+// allowedEndpoints returns the endpoints of all that allow lets calls choose.
+func allowedEndpoints(all config.Endpoints, allow *config.DaemonAllowlist) config.Endpoints {
+	var endpoints config.Endpoints
+	for _, ep := range all {
+		if allow.AllowsEndpoint(ep.Name) {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	return endpoints
+}
+
+// hostResult is one endpoint's share of a fan-out call that did not return a list.
+type hostResult struct {
+	Host   string `json:"Host"`
+	Result any    `json:"Result,omitempty"`
+	Error  string `json:"Error,omitempty"`
+}
+
+// fanOut runs a call against every endpoint concurrently. List items are
+// merged into one array with a "Host" field added; endpoints that fail or
+// return anything else contribute a single hostResult entry.
+func fanOut(ctx context.Context, endpoints config.Endpoints, next func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), request mcp.CallToolRequest) *mcp.CallToolResult {
+	results := make([]*mcp.CallToolResult, len(endpoints))
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = next(config.NewContext(ctx, ep.Config), request)
+		}()
+	}
+	wg.Wait()
+
+	merged := make([]any, 0)
+	failed := 0
+	for i, ep := range endpoints {
+		text := resultText(results[i])
+		if errs[i] != nil || results[i] == nil || results[i].IsError {
+			if errs[i] != nil {
+				text = errs[i].Error()
+			}
+			merged = append(merged, hostResult{Host: ep.Name, Error: text})
+			failed++
+			continue
+		}
+		var items []map[string]any
+		if err := json.Unmarshal([]byte(text), &items); err == nil {
+			for _, item := range items {
+				item["Host"] = ep.Name
+				merged = append(merged, item)
+			}
+			continue
+		}
+		var parsed any
+		if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+			parsed = text
+		}
+		merged = append(merged, hostResult{Host: ep.Name, Result: parsed})
+	}
+
+	prettyJSON, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("Failed to format JSON", err)
+	}
+	if failed == len(endpoints) {
+		return mcp.NewToolResultError(string(prettyJSON))
+	}
+	return mcp.NewToolResultText(string(prettyJSON))
+}
+
+// resultText returns the text of a tool result's first text content.
+func resultText(result *mcp.CallToolResult) string {
+	if result == nil {
+		return ""
+	}
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			return text.Text
+		}
+	}
+	return ""
+}
+
+// hostStatus is one entry of the list_hosts result.
+type hostStatus struct {
+	Name          string  `json:"Name"`
+	Address       string  `json:"Address"`
+	Default       bool    `json:"Default,omitempty"`
+	Reachable     bool    `json:"Reachable"`
+	Version       string  `json:"Version,omitempty"`
+	APIVersion    string  `json:"ApiVersion,omitempty"`
+	Os            string  `json:"Os,omitempty"`
+	Arch          string  `json:"Arch,omitempty"`
+	LatencyMillis float64 `json:"LatencyMs,omitempty"`
+	Error         string  `json:"Error,omitempty"`
+}
+
+// probeHost asks an endpoint for its version and measures the round trip.
+func probeHost(ctx context.Context, ep config.Endpoint) hostStatus {
+	status := hostStatus{Name: ep.Name, Address: config.RedactHost(ep.Address)}
+	req, err := http.NewRequestWithContext(ctx, "GET", ep.Config.BaseURL+"/version", nil)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	req.Header.Set("Accept", "application/json")
+	start := time.Now()
+	resp, err := ep.Config.HTTPClient().Do(req)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	defer resp.Body.Close()
+	status.LatencyMillis = float64(time.Since(start).Microseconds()) / 1000
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	if resp.StatusCode >= 400 {
+		status.Error = fmt.Sprintf("API error: %s", body)
+		return status
+	}
+	var version struct {
+		Version string `json:"Version"`
+		Os      string `json:"Os"`
+		Arch    string `json:"Arch"`
+	}
+	if err := json.Unmarshal(body, &version); err != nil {
+		status.Error = fmt.Sprintf("unexpected /version response: %v", err)
+		return status
+	}
+	status.Reachable = true
+	status.Version = version.Version
+	status.Os = version.Os
+	status.Arch = version.Arch
+	status.APIVersion = ep.Config.NegotiatedAPIVersion()
+	return status
+}
+
+// listHostsTool reports the endpoints and whether each one answers. It is
+// given the endpoints the daemon allowlist lets calls choose, so others are
+// neither probed nor named.
+// defaultCfg is the daemon calls go to without a host argument, unless the
+// call context carries another one.
+func listHostsTool(endpoints config.Endpoints, defaultCfg *config.APIConfig) models.Tool {
+	tool := mcp.NewTool("list_hosts",
+		mcp.WithDescription("List the named Docker endpoints with their reachability, engine version and latency"),
+	)
+	handler := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		defaultCfg := config.FromContext(ctx, defaultCfg)
+		statuses := make([]hostStatus, len(endpoints))
+		var wg sync.WaitGroup
+		for i, ep := range endpoints {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				statuses[i] = probeHost(ctx, ep)
+				statuses[i].Default = ep.Config.Host == defaultCfg.Host
+			}()
+		}
+		wg.Wait()
+
+		prettyJSON, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return mcp.NewToolResultErrorFromErr("Failed to format JSON", err), nil
+		}
+		return mcp.NewToolResultText(string(prettyJSON)), nil
+	}
+	return models.Tool{
+		Definition: tool,
+		Handler:    handler,
+		Method:     "GET",
+		ReadOnly:   true,
+	}
+}
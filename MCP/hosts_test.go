@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func testEndpoints(names ...string) config.Endpoints {
+	var endpoints config.Endpoints
+	for _, name := range names {
+		endpoints = append(endpoints, config.Endpoint{Name: name, Address: "tcp://" + name + ":2375", Config: &config.APIConfig{Name: name}})
+	}
+	return endpoints
+}
+
+func testAllowlist(t *testing.T, endpoints config.Endpoints, entries string) *config.DaemonAllowlist {
+	t.Helper()
+	t.Setenv("ALLOWED_DAEMONS", entries)
+	allow, err := config.LoadDaemonAllowlist(endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return allow
+}
+
+// daemonTool answers like a list tool of the daemon its call goes to: "down"
+// fails, "solo" returns an object and the others a list.
+func daemonTool(fanOut bool) models.Tool {
+	return models.Tool{
+		Definition: mcp.NewTool("get_containers_json"),
+		FanOut:     fanOut,
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name := "default"
+			if cfg := config.FromContext(ctx, nil); cfg != nil {
+				name = cfg.Name
+			}
+			if _, ok := request.GetArguments()["host"]; ok {
+				return mcp.NewToolResultError("host argument passed on"), nil
+			}
+			switch name {
+			case "down":
+				return mcp.NewToolResultError("API error: daemon down"), nil
+			case "solo":
+				return mcp.NewToolResultText(`{"Id":"solo-1"}`), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf(`[{"Id":"%s-1"},{"Id":"%s-2"}]`, name, name)), nil
+		},
+	}
+}
+
+func callTool(t *testing.T, tool models.Tool, args map[string]any) (string, bool) {
+	t.Helper()
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = args
+	result, err := tool.Handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("%s: %v", tool.Definition.Name, err)
+	}
+	return resultText(result), result.IsError
+}
+
+func TestWithHostRouting(t *testing.T) {
+	endpoints := testEndpoints("prod", "staging", "secret")
+	allow := testAllowlist(t, endpoints, "prod,staging")
+	tool := withHost(endpoints, allow)(daemonTool(true))
+	single := withHost(endpoints, allow)(daemonTool(false))
+
+	enum := tool.Definition.InputSchema.Properties["host"].(map[string]any)["enum"]
+	if got := fmt.Sprint(enum); got != "[prod staging *]" {
+		t.Errorf("host enum %s, want the allowed endpoints and *", got)
+	}
+
+	tests := []struct {
+		tool    models.Tool
+		host    any
+		want    string
+		isError bool
+	}{
+		{tool, nil, "default-1", false},
+		{tool, "", "default-1", false},
+		{tool, "staging", "staging-1", false},
+		{tool, "secret", `Host "secret" is not allowed on this server`, true},
+		{tool, "nowhere", `Unknown host "nowhere"`, true},
+		{tool, 5, "Invalid parameter: host", true},
+		{single, "*", `host "*" is only supported by list tools`, true},
+	}
+	for _, tt := range tests {
+		args := map[string]any{}
+		if tt.host != nil {
+			args["host"] = tt.host
+		}
+		text, isError := callTool(t, tt.tool, args)
+		if isError != tt.isError || !strings.Contains(text, tt.want) {
+			t.Errorf("host %v: %q (error %t), want %q (error %t)", tt.host, text, isError, tt.want, tt.isError)
+		}
+	}
+}
+
+func TestFanOutMergesResults(t *testing.T) {
+	endpoints := testEndpoints("prod", "solo", "down", "secret")
+	allow := testAllowlist(t, endpoints, "prod,solo,down")
+	text, isError := callTool(t, withHost(endpoints, allow)(daemonTool(true)), map[string]any{"host": "*"})
+	if isError {
+		t.Fatalf("fan-out failed: %s", text)
+	}
+	var merged []map[string]any
+	if err := json.Unmarshal([]byte(text), &merged); err != nil {
+		t.Fatalf("fan-out result %s: %v", text, err)
+	}
+	want := []map[string]any{
+		{"Id": "prod-1", "Host": "prod"},
+		{"Id": "prod-2", "Host": "prod"},
+		{"Host": "solo", "Result": map[string]any{"Id": "solo-1"}},
+		{"Host": "down", "Error": "API error: daemon down"},
+	}
+	if fmt.Sprint(merged) != fmt.Sprint(want) {
+		t.Errorf("merged\n%v\nwant\n%v", merged, want)
+	}
+
+	// Every endpoint failing fails the call.
+	down := testEndpoints("down")
+	if _, isError := callTool(t, withHost(down, nil)(daemonTool(true)), map[string]any{"host": "*"}); !isError {
+		t.Error("fan-out with every endpoint down succeeded")
+	}
+}
+
+// list_hosts must neither probe nor name endpoints outside ALLOWED_DAEMONS.
+func TestListHostsOnlyAllowedEndpoints(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "1.41")
+	var probes = map[string]*atomic.Int32{"prod": {}, "secret": {}}
+	var endpoints config.Endpoints
+	for _, name := range []string{"prod", "secret"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probes[name].Add(1)
+			fmt.Fprintf(w, `{"Version":"27.0.%d","Os":"linux","Arch":"amd64"}`, len(name))
+		}))
+		defer srv.Close()
+		cfg := &config.APIConfig{Name: name, BaseURL: srv.URL}
+		if err := cfg.Resolve(); err != nil {
+			t.Fatal(err)
+		}
+		endpoints = append(endpoints, config.Endpoint{Name: name, Address: srv.URL, Config: cfg})
+	}
+	allow := testAllowlist(t, endpoints, "prod")
+
+	text, _ := callTool(t, listHostsTool(allowedEndpoints(endpoints, allow), endpoints[0].Config), nil)
+	var statuses []hostStatus
+	if err := json.Unmarshal([]byte(text), &statuses); err != nil {
+		t.Fatalf("list_hosts result %s: %v", text, err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "prod" || !statuses[0].Reachable || !statuses[0].Default || statuses[0].Version != "27.0.4" {
+		t.Errorf("list_hosts = %+v, want only prod, reachable and default", statuses)
+	}
+	if n := probes["secret"].Load(); n != 0 {
+		t.Errorf("the endpoint outside the allowlist was probed %d times", n)
+	}
+}
@@ -1,91 +1,308 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/docker-engine-api/mcp-server/audit"
+	"github.com/docker-engine-api/mcp-server/clientauth"
 	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/metrics"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/docker-engine-api/mcp-server/policy"
+	"github.com/docker-engine-api/mcp-server/ratelimit"
+	"github.com/docker-engine-api/mcp-server/redact"
+	"github.com/docker-engine-api/mcp-server/tracing"
 )
 
+var (
+	configFile  = flag.String("config", "", "YAML or JSON configuration file (default $CONFIG_FILE)")
+	hashToken   = flag.Bool("hash-token", false, "Read a client token from stdin and print its CLIENT_TOKENS_FILE entry")
+	verifyAudit = flag.String("verify-audit", "", "Check the hash chain of an audit log and its rotated files, then exit")
+)
+
+// auditLog records state-changing tool calls; nil when AUDIT_LOG is not set.
+var auditLog *audit.Log
+
 func main() {
+	flag.Parse()
+	if *hashToken {
+		token, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && token == "" {
+			log.Fatalf("Failed to read token: %v", err)
+		}
+		fmt.Println("<name>", clientauth.HashToken(strings.TrimSpace(token)))
+		return
+	}
+	if *verifyAudit != "" {
+		n, err := verifyAuditFiles(*verifyAudit)
+		if err != nil {
+			log.Fatalf("Audit log verification failed after %d entries: %v", n, err)
+		}
+		fmt.Printf("%d entries verified\n", n)
+		return
+	}
+	filename := *configFile
+	if filename == "" {
+		filename = os.Getenv("CONFIG_FILE")
+	}
+	var file *config.File
+	if filename != "" {
+		var err error
+		if file, err = config.LoadFile(filename); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		config.UseFile(file)
+	}
+	if logFile := config.Setting("LOG_FILE"); logFile != "" {
+		out, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		log.SetOutput(out)
+	}
+	// Spans go to stderr in STDIO mode, where stdout carries the protocol.
+	traceOut := io.Writer(os.Stdout)
+	if mode := strings.ToUpper(config.Setting("TRANSPORT")); mode == "" || mode == "STDIO" {
+		traceOut = os.Stderr
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:     config.Setting("TRACING_EXPORTER"),
+		File:         config.Setting("TRACING_FILE"),
+		OTLPEndpoint: config.Setting("TRACING_OTLP_ENDPOINT"),
+		Stdout:       traceOut,
+		Version:      config.MaxAPIVersion,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(ctx)
+	}()
+	if config.Setting("TRACING_EXPORTER") != "" {
+		config.SetTransportMiddleware(tracing.Transport)
+	}
+
 	cfg, err := config.LoadAPIConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	endpoints, err := config.LoadEndpoints()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if len(endpoints) > 0 {
+		log.Printf("Routing calls to %d named endpoints: %v", len(endpoints), endpoints.Names())
+	}
+	allow, err := config.LoadDaemonAllowlist(endpoints)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	limits, err := config.LoadLimits()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if _, err := config.LoadConfirmModes(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	pol, err := loadPolicy(config.Setting("POLICY_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if _, err := loadOutputRedaction(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if _, err := config.LoadToolsets(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
-	// Check transport environment variable (both uppercase and lowercase)
-	transport := os.Getenv("TRANSPORT")
+	// Check transport setting (both uppercase and lowercase)
+	transport := config.Setting("TRANSPORT")
 	if transport == "" {
-		transport = os.Getenv("transport")
+		transport = config.Setting("transport")
+	}
+	drainTimeout := defaultDrainTimeout
+	if val := config.Setting("DRAIN_TIMEOUT"); val != "" {
+		if drainTimeout, err = config.ParseDuration(val); err != nil {
+			log.Fatalf("DRAIN_TIMEOUT: %v", err)
+		}
 	}
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// HTTP/HTTPS Mode - if transport is "http", "HTTP", "https", or "HTTPS"
-	if transport == "http" || transport == "HTTP" || transport == "https" || transport == "HTTPS" {
+	// Tools are built once and rebuilt when the configuration file changes.
+	mode := strings.ToUpper(transport)
+	if mode == "" {
+		mode = "STDIO"
+	}
+	auditOpts, err := loadAuditOptions()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if auditLog, err = audit.Open(auditOpts); err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+	config.SetRequestObserver(func(endpoint string, req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+		metrics.ObserveDaemonRequest(endpoint, req, resp, err, elapsed)
+		audit.ObserveDaemonRequest(endpoint, req, resp, err, elapsed)
+	})
+	hooks := &server.Hooks{}
+	mcpSrv := createMCPServer(hooks)
+	tools := newToolSet(mcpSrv, mode, file, cfg, endpoints, allow, ratelimit.New(limits), pol)
+	if filename != "" {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go watchConfig(watchCtx, filename, func() { tools.reload(filename) })
+	}
+
+	// Network modes: HTTP and HTTPS serve streamable HTTP on /mcp, SSE serves
+	// the legacy /sse and /message endpoints, and COMBINED serves both.
+	if networkMode(mode) {
 		port := cfg.Port
 		if port == "" {
-			log.Fatalf("PORT environment variable is required for HTTP/HTTPS mode. Please set PORT environment variable.")
+			log.Fatalf("PORT environment variable is required for %s mode. Please set PORT environment variable.", mode)
 		}
+		transport = mode
+		serveStreamable := mode != "SSE"
+		serveSSE := mode == "SSE" || mode == "COMBINED"
+		// SSE and combined modes use TLS when a certificate is configured.
+		isHTTPS := mode == "HTTPS" || (serveSSE && config.Setting("CERT_FILE") != "" && config.Setting("KEY_FILE") != "")
 
-		// Determine if HTTPS mode and normalize transport
-		isHTTPS := transport == "https" || transport == "HTTPS"
-		if isHTTPS {
-			transport = "HTTPS"
-		} else {
-			transport = "HTTP"
-		}
-		
 		log.Printf("Running in %s mode on port %s", transport, port)
 
-		mux := http.NewServeMux()
-		mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
-			// Read headers for dynamic config
-			apiCfg := &config.APIConfig{
-				BaseURL:     r.Header.Get("API_BASE_URL"),
-				BearerToken: r.Header.Get("BEARER_TOKEN"),
-				APIKey:      r.Header.Get("API_KEY"),
-				BasicAuth:   r.Header.Get("BASIC_AUTH"),
+		idle := defaultSessionIdleTimeout
+		if val := config.Setting("SESSION_IDLE_TIMEOUT"); val != "" {
+			if idle, err = config.ParseDuration(val); err != nil {
+				log.Fatalf("SESSION_IDLE_TIMEOUT: %v", err)
 			}
+		}
+		sessions := newSessionStore(idle)
+		sessions.attach(hooks)
+		metrics.RegisterSessions(sessions.count)
+		expireCtx, stopExpiry := context.WithCancel(context.Background())
+		defer stopExpiry()
+		go sessions.expire(expireCtx, time.Minute)
 
-			if apiCfg.BaseURL == "" {
-				http.Error(w, "Missing API_BASE_URL header", http.StatusBadRequest)
-				return
+		// Clients must authenticate before any request reaches the MCP server.
+		auth, err := clientauth.New(config.Setting("CLIENT_TOKENS_FILE"), config.Setting("CLIENT_CA_FILE"))
+		if err != nil {
+			log.Fatalf("Failed to load client authentication: %v", err)
+		}
+		if auth == nil {
+			log.Printf("Client authentication is disabled: anyone who can reach port %s can use the daemon", port)
+		} else if config.Setting("CLIENT_CA_FILE") != "" && !isHTTPS {
+			log.Fatalf("CLIENT_CA_FILE requires HTTPS: set TRANSPORT=https, or CERT_FILE and KEY_FILE in %s mode", mode)
+		}
+
+		if config.SettingBool("IGNORE_API_BASE_URL_HEADER") {
+			log.Println("Ignoring API_BASE_URL headers, sessions use the configured daemons only")
+		} else if _, allow := tools.daemonAllowlist(); allow == nil {
+			log.Println("WARNING: ALLOWED_DAEMONS is not set, clients may point the server at any address with API_BASE_URL")
+		}
+
+		// sessionConfig reads the daemon config a new session keeps until it
+		// ends. With named endpoints the first one is used when the client
+		// does not pick a daemon; API_BASE_URL may also name an endpoint.
+		// Addresses outside the daemon allowlist are refused with 403.
+		var sessionConfig sessionConfigFunc = func(r *http.Request) (*config.APIConfig, int, error) {
+			baseURL := r.Header.Get("API_BASE_URL")
+			if config.SettingBool("IGNORE_API_BASE_URL_HEADER") {
+				if apiCfg := tools.defaultEndpoint(); apiCfg != nil {
+					return apiCfg, 0, nil
+				}
+				if cfg.Host == "" {
+					return nil, http.StatusServiceUnavailable, fmt.Errorf("No daemon is configured on the server")
+				}
+				return cfg, 0, nil
+			}
+			if apiCfg := tools.defaultEndpoint(); apiCfg != nil && baseURL == "" {
+				return apiCfg, 0, nil
 			}
+			endpoints, allow := tools.daemonAllowlist()
+			if ep, ok := endpoints.Lookup(baseURL); ok {
+				if !allow.AllowsEndpoint(ep.Name) {
+					return nil, http.StatusForbidden, fmt.Errorf("%w: %s", config.ErrDaemonNotAllowed, ep.Name)
+				}
+				return ep.Config, 0, nil
+			}
+			apiCfg, err := config.LoadHeaderConfig(r.Header, allow)
+			if errors.Is(err, config.ErrDaemonNotAllowed) {
+				return nil, http.StatusForbidden, err
+			}
+			return apiCfg, http.StatusBadRequest, err
+		}
+
+		// One server serves every session; each call reads the daemon config
+		// of its session from the context.
+		tools.apply()
+		mux := http.NewServeMux()
 
-			log.Printf("Incoming HTTP request - BaseURL: %s", apiCfg.BaseURL)
+		if serveStreamable {
+			streamable := server.NewStreamableHTTPServer(mcpSrv,
+				server.WithSessionIdManager(sessions),
+				server.WithHTTPContextFunc(sessions.contextFunc),
+			)
+			// Initialize requests start a new session, which keeps the
+			// daemon config from their headers until it expires.
+			mux.Handle("/mcp", auth.Middleware(streamableHandler(streamable, sessionConfig)))
+		}
 
-			// Create MCP server for this request
-			mcpSrv := createMCPServer(apiCfg, transport)
-			handler := server.NewStreamableHTTPServer(mcpSrv, server.WithHTTPContextFunc(
-				func(ctx context.Context, req *http.Request) context.Context {
-					return context.WithValue(ctx, "apiConfig", apiCfg)
-				},
-			))
+		if serveSSE {
+			sse := server.NewSSEServer(mcpSrv,
+				server.WithSSEContextFunc(sessions.contextFunc),
+				server.WithKeepAlive(true),
+			)
+			// The event stream opens the session, so its headers carry the
+			// daemon config; messages are then posted with the session id.
+			mux.Handle("/sse", auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				apiCfg, status, err := sessionConfig(r)
+				if err != nil {
+					http.Error(w, err.Error(), status)
+					return
+				}
+				if r, err = sessionRedaction(r); err != nil {
+					http.Error(w, err.Error(), http.StatusForbidden)
+					return
+				}
+				sse.SSEHandler().ServeHTTP(w, r.WithContext(config.NewContext(r.Context(), apiCfg)))
+			})))
+			mux.Handle("/message", auth.Middleware(sse.MessageHandler()))
+		}
 
-			handler.ServeHTTP(w, r)
-		})
+		// Rate limit state, including client names, for monitoring.
+		mux.Handle("/limits", auth.Middleware(limitsHandler(tools)))
 
-		mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(`{"status":"ok"}`))
-		})
+		mux.Handle("/metrics", auth.Middleware(metrics.Handler()))
+		mux.HandleFunc("/healthz", healthzHandler)
+		mux.Handle("/readyz", readyzHandler(tools))
+		mux.HandleFunc("/", healthzHandler)
 
 		addr := net.JoinHostPort("0.0.0.0", port)
-		httpServer := &http.Server{Addr: addr, Handler: mux}
+		httpServer := &http.Server{Addr: addr, Handler: tracing.Handler(mux), TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12}}
+		auth.TLSConfig(httpServer.TLSConfig)
 
 		go func() {
 			// Check if HTTPS mode
 			if isHTTPS {
-				certFile := os.Getenv("CERT_FILE")
-				keyFile := os.Getenv("KEY_FILE")
+				certFile := config.Setting("CERT_FILE")
+				keyFile := config.Setting("KEY_FILE")
 				
 				if certFile == "" || keyFile == "" {
 					log.Fatalf("CERT_FILE and KEY_FILE environment variables are required for HTTPS mode")
@@ -105,11 +322,16 @@ func main() {
 
 		<-sigChan
 		log.Println("Shutdown signal received")
+		// Keep serving while calls drain, so clients get their results and
+		// new calls a "server shutting down" error; /readyz reports 503.
+		drain.drain(drainTimeout)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := httpServer.Shutdown(ctx); err != nil {
-			log.Printf("Shutdown error: %v", err)
+			// Open SSE and streamable HTTP streams never go idle.
+			log.Printf("Shutdown error: %v, closing remaining connections", err)
+			httpServer.Close()
 		} else {
 			log.Println("HTTP server shutdown complete")
 		}
@@ -117,29 +339,114 @@ func main() {
 	}
 
 	// STDIO Mode - default when no transport or transport is "stdio"
-	log.Println("Running in STDIO mode")
-	mcp := createMCPServer(cfg, "STDIO")
+	log.Printf("Running in STDIO mode against %s", config.RedactHost(cfg.Host))
+	pingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if version, err := cfg.APIVersion(pingCtx); err != nil {
+		log.Printf("Daemon not reachable yet, API version will be negotiated on first call: %v", err)
+	} else {
+		log.Printf("Using Engine API v%s", version)
+	}
+	cancel()
+	tools.apply()
+	// STDIO has a single session and no HTTP listener of its own; metrics and
+	// probes get a separate one when METRICS_ADDR is set.
+	metrics.RegisterSessions(func() int { return 1 })
+	if addr := config.Setting("METRICS_ADDR"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.Handle("/limits", limitsHandler(tools))
+		mux.HandleFunc("/healthz", healthzHandler)
+		mux.Handle("/readyz", readyzHandler(tools))
+		go func() {
+			log.Printf("Serving metrics on %s", addr)
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Fatalf("Metrics server error: %v", err)
+			}
+		}()
+	}
+	// Listen rather than ServeStdio, which cancels running calls as soon as a
+	// signal arrives. A closed stdin means the client is gone: cancel its
+	// calls so Listen can return and the process exits.
+	stdio := server.NewStdioServer(mcpSrv)
+	listenCtx, stopListening := context.WithCancel(context.Background())
+	defer stopListening()
+	done := make(chan error, 1)
 	go func() {
-		if err := server.ServeStdio(mcp); err != nil {
-			log.Fatalf("STDIO error: %v", err)
-		}
+		done <- stdio.Listen(listenCtx, &eofReader{r: os.Stdin, onEOF: drain.abort}, os.Stdout)
 	}()
-	<-sigChan
-	log.Println("Received shutdown signal. Exiting STDIO mode.")
+	select {
+	case err := <-done:
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("STDIO error: %v", err)
+		}
+		log.Println("STDIO client disconnected. Exiting.")
+	case <-sigChan:
+		log.Println("Received shutdown signal. Exiting STDIO mode.")
+		drain.drain(drainTimeout)
+	}
 }
 
-func createMCPServer(cfg *config.APIConfig, mode string) *server.MCPServer {
-	mcp := server.NewMCPServer("Docker Engine API", "1.33",
+// calls tracks the running tool calls of every session, so a cancellation
+// can reach the call it names regardless of which HTTP request delivers it.
+var calls = newInflightCalls()
+
+// createMCPServer creates the server all sessions share; callers may add
+// their own hooks to hooks afterwards.
+func createMCPServer(hooks *server.Hooks) *server.MCPServer {
+	mcp := server.NewMCPServer("Docker Engine API", config.MaxAPIVersion,
 		server.WithToolCapabilities(true),
 		server.WithRecovery(),
+		server.WithHooks(hooks),
 	)
+	calls.attach(mcp, hooks)
+	return mcp
+}
 
-	tools := GetAll(cfg)
-	log.Printf("Loaded %d tools for %s mode", len(tools), mode)
+// networkMode reports whether mode serves MCP clients over the network
+// rather than STDIO.
+func networkMode(mode string) bool {
+	return mode == "HTTP" || mode == "HTTPS" || mode == "SSE" || mode == "COMBINED"
+}
 
-	for _, tool := range tools {
-		mcp.AddTool(tool.Definition, tool.Handler)
+// buildTools wraps every tool for the given daemon and endpoints and drops
+// the ones excluded by TOOLSETS, TOOLS_ALLOW and TOOLS_DENY.
+func buildTools(cfg *config.APIConfig, endpoints config.Endpoints, allow *config.DaemonAllowlist, limiter *ratelimit.Limiter, pol *policy.Policy, mode string) []models.Tool {
+	confirmModes, err := config.LoadConfirmModes()
+	if err != nil {
+		log.Printf("Invalid destructive tool modes, previewing every destructive tool: %v", err)
+	}
+	redaction, err := loadOutputRedaction()
+	if err != nil {
+		log.Printf("Invalid output redaction settings, using the default patterns: %v", err)
+		redaction, _ = redact.NewOutput(nil)
 	}
+	middleware := []toolMiddleware{withRedaction(redaction), tracing.Middleware, metrics.Middleware, auditLog.Middleware, drain.middleware, withRateLimit(limiter), withPolicy(pol), withDockerContext(mode, allow), calls.middleware, withHost(endpoints, allow), withTimeout(cfg), withAPIVersion(cfg), withConfirm(cfg, confirmModes)}
+	if config.SettingBool("LOG_TOOL_CALLS") {
+		middleware = append([]toolMiddleware{withCallLog}, middleware...)
+	}
+	tools := applyMiddleware(GetAll(cfg), middleware...)
+	if hosts := allowedEndpoints(endpoints, allow); len(hosts) > 0 {
+		tools = append(tools, applyMiddleware([]models.Tool{listHostsTool(hosts, cfg)}, withRedaction(redaction), tracing.Middleware, metrics.Middleware, drain.middleware, withRateLimit(limiter), calls.middleware, withTimeout(cfg))...)
+	}
+	tools = filterTools(tools, config.SettingList("TOOLSETS"), config.SettingList("TOOLS_ALLOW"), config.SettingList("TOOLS_DENY"))
 
-	return mcp
-}
\ No newline at end of file
+	// When the daemon's API version is already known, hide the tools it cannot
+	// serve. Other named endpoints may still serve them, so keep them then.
+	version := cfg.NegotiatedAPIVersion()
+	if len(endpoints) > 0 {
+		version = ""
+	}
+	supported := make([]models.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if version != "" && tool.MinAPIVersion != "" && config.VersionLess(version, tool.MinAPIVersion) {
+			log.Printf("Skipping %s: requires API v%s, daemon has v%s", tool.Definition.Name, tool.MinAPIVersion, version)
+			continue
+		}
+		supported = append(supported, tool)
+	}
+	if config.ReadOnly() {
+		log.Printf("Read-only mode: only tools that do not change daemon state are registered")
+	}
+	log.Printf("Loaded %d tools for %s mode", len(supported), mode)
+	return supported
+}
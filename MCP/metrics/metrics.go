@@ -0,0 +1,129 @@
+// Package metrics exposes Prometheus metrics for tool calls, daemon requests
+// and sessions.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// headerEndpoint labels daemons that clients chose in request headers, so
+// arbitrary addresses do not become label values.
+const headerEndpoint = "header"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	toolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_tool_calls_total",
+		Help: "Tool calls by tool and outcome (success, error, cancelled or rate_limited).",
+	}, []string{"tool", "outcome"})
+
+	toolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcp_tool_call_duration_seconds",
+		Help:    "Tool call latency by tool.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"tool"})
+
+	streamingCalls = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcp_streaming_calls_in_flight",
+		Help: "Streaming tool calls (logs, events, stats, waits, attaches, pulls) currently running.",
+	}, []string{"tool"})
+
+	daemonRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docker_daemon_requests_total",
+		Help: "Requests sent to Docker daemons by endpoint, method and HTTP status code (\"error\" when no response was received).",
+	}, []string{"endpoint", "method", "code"})
+
+	daemonDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docker_daemon_request_duration_seconds",
+		Help:    "Time to the response headers of daemon requests by endpoint.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		toolCalls, toolDuration, streamingCalls, daemonRequests, daemonDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// RegisterSessions reports the number of active MCP sessions from count.
+func RegisterSessions(count func() int) {
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "mcp_active_sessions",
+		Help: "MCP sessions currently open.",
+	}, func() float64 { return float64(count()) }))
+}
+
+// Middleware records the calls, outcomes and latency of a tool. It is the
+// single place tool handlers are instrumented.
+func Middleware(tool models.Tool) models.Tool {
+	name := tool.Definition.Name
+	next := tool.Handler
+	tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if tool.Streaming {
+			streamingCalls.WithLabelValues(name).Inc()
+			defer streamingCalls.WithLabelValues(name).Dec()
+		}
+		start := time.Now()
+		result, err := next(ctx, request)
+		toolDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		toolCalls.WithLabelValues(name, outcome(ctx, result, err)).Inc()
+		return result, err
+	}
+	return tool
+}
+
+// outcome classifies a call from what the handler returned. The cancellation
+// and drain middleware run inside this one with their own contexts, so a
+// cancelled call shows in its result, not in ctx; ctx only ends when the
+// client's whole request does.
+func outcome(ctx context.Context, result *mcp.CallToolResult, err error) string {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(ctx.Err(), context.Canceled):
+		return "cancelled"
+	case err != nil:
+		return "error"
+	case result != nil && result.IsError:
+		if structured, ok := result.StructuredContent.(map[string]any); ok {
+			switch structured["error"] {
+			case "rate_limited", "cancelled":
+				return structured["error"].(string)
+			}
+		}
+		return "error"
+	default:
+		return "success"
+	}
+}
+
+// ObserveDaemonRequest records one request to a daemon; it matches
+// config.RequestObserver.
+func ObserveDaemonRequest(endpoint string, req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	if endpoint == "" {
+		endpoint = headerEndpoint
+	}
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	daemonRequests.WithLabelValues(endpoint, req.Method, code).Inc()
+	daemonDuration.WithLabelValues(endpoint).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestOutcome(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	failed := mcp.NewToolResultError("API error")
+	stopped := mcp.NewToolResultStructured(map[string]any{"error": "cancelled"}, "Cancelled: get_events was cancelled")
+	stopped.IsError = true
+	limited := mcp.NewToolResultStructured(map[string]any{"error": "rate_limited"}, "rate limited")
+	limited.IsError = true
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		result *mcp.CallToolResult
+		err    error
+		want   string
+	}{
+		{"success", context.Background(), mcp.NewToolResultText("ok"), nil, "success"},
+		{"failed", context.Background(), failed, nil, "error"},
+		{"handler error", context.Background(), nil, errors.New("boom"), "error"},
+		{"cancelled call", context.Background(), stopped, nil, "cancelled"},
+		{"cancelled error", context.Background(), nil, fmt.Errorf("read: %w", context.Canceled), "cancelled"},
+		{"request gone", cancelled, failed, nil, "cancelled"},
+		{"rate limited", context.Background(), limited, nil, "rate_limited"},
+	}
+	for _, tt := range tests {
+		if got := outcome(tt.ctx, tt.result, tt.err); got != tt.want {
+			t.Errorf("%s: outcome %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
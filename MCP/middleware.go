@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/clientauth"
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/docker-engine-api/mcp-server/ratelimit"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// toolMiddleware decorates a tool with behaviour shared by every tool,
+// usually an extra argument and a wrapped handler.
+type toolMiddleware func(models.Tool) models.Tool
+
+// applyMiddleware wraps every tool; the first middleware ends up outermost.
+func applyMiddleware(tools []models.Tool, middleware ...toolMiddleware) []models.Tool {
+	wrapped := make([]models.Tool, 0, len(tools))
+	for _, tool := range tools {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			tool = middleware[i](tool)
+		}
+		wrapped = append(wrapped, tool)
+	}
+	return wrapped
+}
+
+// takeArg removes a middleware-owned argument from the request so it is not
+// forwarded to the Engine API as a query parameter or body field.
+func takeArg(request *mcp.CallToolRequest, name string) (any, bool) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	val, ok := args[name]
+	if !ok {
+		return nil, false
+	}
+	rest := make(map[string]any, len(args)-1)
+	for k, v := range args {
+		if k != name {
+			rest[k] = v
+		}
+	}
+	request.Params.Arguments = rest
+	return val, true
+}
+
+// withDockerContext adds the optional "context" argument, which sends a single
+// call to a Docker CLI context instead of the configured daemon. Contexts
+// are read from the server's Docker config and use its local socket and
+// credentials, so the argument is only offered in STDIO mode; network
+// clients choose daemons through headers and named endpoints. Contexts
+// pointing outside the daemon allowlist are refused.
+func withDockerContext(mode string, allow *config.DaemonAllowlist) toolMiddleware {
+	return func(tool models.Tool) models.Tool {
+		if networkMode(mode) {
+			return tool
+		}
+		return dockerContextArg(tool, allow)
+	}
+}
+
+func dockerContextArg(tool models.Tool, allow *config.DaemonAllowlist) models.Tool {
+	mcp.WithString("context", mcp.Description("Docker CLI context to send this call to instead of the configured daemon"))(&tool.Definition)
+	next := tool.Handler
+	tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		val, ok := takeArg(&request, "context")
+		if !ok {
+			return next(ctx, request)
+		}
+		name, ok := val.(string)
+		if !ok {
+			return mcp.NewToolResultError("Invalid parameter: context"), nil
+		}
+		if name == "" {
+			return next(ctx, request)
+		}
+		if host, _ := request.GetArguments()["host"].(string); host != "" {
+			return mcp.NewToolResultError("Invalid parameters: context and host cannot be combined"), nil
+		}
+		cfg, err := config.LoadDockerContext(name, allow)
+		if errors.Is(err, config.ErrDaemonNotAllowed) {
+			log.Printf("Refused %s: %v%s", tool.Definition.Name, err, clientSuffix(ctx))
+		}
+		if err != nil {
+			return mcp.NewToolResultErrorFromErr("Failed to load Docker context", err), nil
+		}
+		return next(config.NewContext(ctx, cfg), request)
+	}
+	return tool
+}
+
+// withAPIVersion rejects calls to endpoints the daemon's negotiated API
+// version does not have, instead of letting the daemon answer with a 404.
+func withAPIVersion(cfg *config.APIConfig) toolMiddleware {
+	return func(tool models.Tool) models.Tool {
+		if tool.MinAPIVersion == "" {
+			return tool
+		}
+		next := tool.Handler
+		tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			// Negotiation errors are left to the handler, which reports the unreachable daemon.
+			if version, err := config.FromContext(ctx, cfg).APIVersion(ctx); err == nil && config.VersionLess(version, tool.MinAPIVersion) {
+				return mcp.NewToolResultError(fmt.Sprintf("%s is unsupported by daemon API v%s (requires v%s)", tool.Definition.Name, version, tool.MinAPIVersion)), nil
+			}
+			return next(ctx, request)
+		}
+		return tool
+	}
+}
+
+// withTimeout bounds every call with a deadline: the optional timeout_seconds
+// argument, or the short or long default from the client options.
+func withTimeout(cfg *config.APIConfig) toolMiddleware {
+	return func(tool models.Tool) models.Tool {
+		mcp.WithNumber("timeout_seconds", mcp.Description("Abort the call after this many seconds instead of the server default"))(&tool.Definition)
+		next := tool.Handler
+		tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			// Deadlines are server policy, so they come from the server's
+			// config even when the call targets another daemon.
+			timeout := cfg.Client.CallTimeout(tool.LongRunning)
+			if val, ok := takeArg(&request, "timeout_seconds"); ok {
+				secs, ok := val.(float64)
+				if !ok || secs <= 0 {
+					return mcp.NewToolResultError("Invalid parameter: timeout_seconds must be a positive number"), nil
+				}
+				timeout = time.Duration(secs * float64(time.Second))
+			}
+			if timeout <= 0 {
+				return next(ctx, request)
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			result, err := next(ctx, request)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return mcp.NewToolResultError(fmt.Sprintf("Timed out: %s did not finish within %s", tool.Definition.Name, timeout)), nil
+			}
+			return result, err
+		}
+		return tool
+	}
+}
+
+// withCallLog logs every call with its duration and whether it failed.
+func withCallLog(tool models.Tool) models.Tool {
+	next := tool.Handler
+	tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, request)
+		failed := err != nil || (result != nil && result.IsError)
+		log.Printf("Tool call %s finished in %s (error: %t)%s", tool.Definition.Name, time.Since(start).Round(time.Millisecond), failed, clientSuffix(ctx))
+		return result, err
+	}
+	return tool
+}
+
+// toolCategory sorts a tool into the rate limit category matching the load
+// it puts on the daemon.
+func toolCategory(tool models.Tool) ratelimit.Category {
+	switch {
+	case tool.LongRunning:
+		return ratelimit.Stream
+	case tool.ReadOnly:
+		return ratelimit.Read
+	default:
+		return ratelimit.Mutate
+	}
+}
+
+// remoteAddrKey is the context key for the address of the HTTP client a
+// call came from.
+type remoteAddrKey struct{}
+
+// withRemoteAddr records the IP address r came from, without the port.
+func withRemoteAddr(ctx context.Context, r *http.Request) context.Context {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return context.WithValue(ctx, remoteAddrKey{}, host)
+}
+
+// rateLimitClient identifies the caller for per-client limits: the
+// authenticated client, or the remote address when clients do not
+// authenticate. Session ids are not used for that, as a client can open as
+// many sessions as it likes; only STDIO, with its one session, falls back
+// to it.
+func rateLimitClient(ctx context.Context) string {
+	if id, ok := clientauth.FromContext(ctx); ok {
+		return id.Name
+	}
+	if addr, _ := ctx.Value(remoteAddrKey{}).(string); addr != "" {
+		return "address " + addr
+	}
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// withRateLimit refuses calls over the configured rate and concurrency
+// limits with an error telling the client when to retry.
+func withRateLimit(limiter *ratelimit.Limiter) toolMiddleware {
+	return func(tool models.Tool) models.Tool {
+		if limiter == nil {
+			return tool
+		}
+		category := toolCategory(tool)
+		next := tool.Handler
+		tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			release, err := limiter.Acquire(rateLimitClient(ctx), category)
+			var limited *ratelimit.Error
+			if errors.As(err, &limited) {
+				log.Printf("Refused %s: %v%s", tool.Definition.Name, limited, clientSuffix(ctx))
+				result := mcp.NewToolResultStructured(map[string]any{
+					"error":               "rate_limited",
+					"scope":               limited.Scope,
+					"retry_after_seconds": limited.RetryAfterSeconds(),
+				}, limited.Error())
+				result.IsError = true
+				return result, nil
+			}
+			defer release()
+			return next(ctx, request)
+		}
+		return tool
+	}
+}
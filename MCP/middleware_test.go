@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// deadlineTool records the deadline of the call that reaches it and the
+// arguments it was given.
+func deadlineTool(longRunning bool, deadline *time.Duration, args *map[string]any) models.Tool {
+	return models.Tool{
+		Definition:  mcp.NewTool("get_containers_json"),
+		LongRunning: longRunning,
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			*deadline = 0
+			if d, ok := ctx.Deadline(); ok {
+				*deadline = time.Until(d)
+			}
+			*args = request.GetArguments()
+			return mcp.NewToolResultText("ok"), nil
+		},
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	cfg := &config.APIConfig{Client: config.ClientOptions{DefaultTimeout: 30 * time.Second, LongTimeout: 30 * time.Minute}}
+	tests := []struct {
+		name        string
+		cfg         *config.APIConfig
+		longRunning bool
+		args        map[string]any
+		want        time.Duration // zero when the call has no deadline
+		wantErr     string
+	}{
+		{name: "default", cfg: cfg, want: 30 * time.Second},
+		{name: "long running", cfg: cfg, longRunning: true, want: 30 * time.Minute},
+		{name: "override", cfg: cfg, args: map[string]any{"timeout_seconds": 90.0}, want: 90 * time.Second},
+		{name: "override of a long call", cfg: cfg, longRunning: true, args: map[string]any{"timeout_seconds": 0.5}, want: 500 * time.Millisecond},
+		{name: "zero", cfg: cfg, args: map[string]any{"timeout_seconds": 0.0}, wantErr: "timeout_seconds must be a positive number"},
+		{name: "negative", cfg: cfg, args: map[string]any{"timeout_seconds": -5.0}, wantErr: "timeout_seconds must be a positive number"},
+		{name: "not a number", cfg: cfg, args: map[string]any{"timeout_seconds": "60"}, wantErr: "timeout_seconds must be a positive number"},
+		{name: "no default", cfg: &config.APIConfig{}},
+		{name: "override without a default", cfg: &config.APIConfig{}, args: map[string]any{"timeout_seconds": 2.0}, want: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadline, got := time.Duration(-1), map[string]any(nil)
+			tool := withTimeout(tt.cfg)(deadlineTool(tt.longRunning, &deadline, &got))
+			if _, ok := tool.Definition.InputSchema.Properties["timeout_seconds"]; !ok {
+				t.Error("timeout_seconds is not in the input schema")
+			}
+			args := map[string]any{"all": true}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			result := callWith(t, tool, args)
+			if tt.wantErr != "" {
+				if !result.IsError || !strings.Contains(resultText(result), tt.wantErr) {
+					t.Errorf("result %q, want an error with %q", resultText(result), tt.wantErr)
+				}
+				if deadline != -1 {
+					t.Error("an invalid timeout_seconds reached the tool")
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("call failed: %s", resultText(result))
+			}
+			if tt.want == 0 && deadline != 0 {
+				t.Errorf("deadline in %s, want none", deadline)
+			}
+			if tt.want != 0 && (deadline > tt.want || deadline < tt.want-time.Second) {
+				t.Errorf("deadline in %s, want %s", deadline, tt.want)
+			}
+			if _, ok := got["timeout_seconds"]; ok || got["all"] != true {
+				t.Errorf("tool got arguments %v, want timeout_seconds removed", got)
+			}
+		})
+	}
+}
+
+// A call that runs past its deadline reports the timeout as a tool error,
+// whatever the handler itself returned.
+func TestWithTimeoutReportsDeadline(t *testing.T) {
+	slow := models.Tool{
+		Definition: mcp.NewTool("get_containers_json"),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	tool := withTimeout(&config.APIConfig{Client: config.ClientOptions{DefaultTimeout: time.Hour}})(slow)
+	result := callWith(t, tool, map[string]any{"timeout_seconds": 0.05})
+	if want := "Timed out: get_containers_json did not finish within 50ms"; !result.IsError || resultText(result) != want {
+		t.Errorf("result %q, want %q", resultText(result), want)
+	}
+
+	// A call cancelled for another reason is not reported as a timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{}
+	if _, err := tool.Handler(ctx, request); err != context.Canceled {
+		t.Errorf("cancelled call returned %v, want context.Canceled", err)
+	}
+}
@@ -8,7 +8,39 @@ import (
 type Tool struct {
 	Definition mcp.Tool
 	Handler    func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error)
-}
+	// Toolset is the group the tool is enabled with in TOOLSETS; empty means always enabled.
+	Toolset string
+	// Method is the HTTP method of the Engine API request the tool sends.
+	Method string
+	// ReadOnly tools do not change daemon state; only they are registered in read-only mode.
+	ReadOnly bool
+	// Destructive tools delete data or leave the cluster; by default they only run with confirm: true.
+	Destructive bool
+	// MinAPIVersion is the oldest Engine API version that has this endpoint; empty means any.
+	MinAPIVersion string
+	// LongRunning tools (pulls, pushes, builds, prunes, streams) get the long default deadline.
+	LongRunning bool
+	// Streaming tools (logs, events, stats, waits, attaches, pulls) hold a stream open; shutdown closes them at once.
+	Streaming bool
+	// FanOut tools are read-only lists that may be sent to every endpoint with host "*".
+	FanOut bool
+}
+
+// Toolsets group the tools by the objects they manage, so servers can expose
+// only the areas an agent needs.
+const (
+	ToolsetContainers = "containers"
+	ToolsetImages     = "images"
+	ToolsetVolumes    = "volumes"
+	ToolsetNetworks   = "networks"
+	ToolsetSwarm      = "swarm" // Nodes, services, tasks, secrets and configs too
+	ToolsetPlugins    = "plugins"
+	ToolsetSystem     = "system"
+	ToolsetExec       = "exec" // Exec instances and attaching to containers
+)
+
+// Toolsets lists every toolset.
+var Toolsets = []string{ToolsetContainers, ToolsetImages, ToolsetVolumes, ToolsetNetworks, ToolsetSwarm, ToolsetPlugins, ToolsetSystem, ToolsetExec}
 
 // ClusterInfo represents the ClusterInfo schema from the OpenAPI specification
 type ClusterInfo struct {
@@ -0,0 +1,265 @@
+// Package policy checks the containers and services that tools create or
+// update against a rule file. Rules deny, warn about or rewrite requests
+// that ask for privileges, host namespaces, host mounts or devices, or that
+// lack resource limits. Decisions depend only on the tool arguments, so no
+// daemon is needed to evaluate them.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Action is what a rule does with a matching request.
+type Action string
+
+const (
+	Deny   Action = "deny"   // Refuse the call
+	Warn   Action = "warn"   // Run the call and report the rule in the result
+	Mutate Action = "mutate" // Rewrite the request with the rule's Set and run it
+)
+
+// Condition names what a rule looks for in a request.
+type Condition string
+
+const (
+	Any           Condition = "any"             // Every request
+	Privileged    Condition = "privileged"      // HostConfig.Privileged
+	HostNetwork   Condition = "host_network"    // NetworkMode "host", or the service network "host"
+	HostPID       Condition = "host_pid"        // PidMode "host"
+	CapAdd        Condition = "cap_add"         // Added capabilities, optionally only those in Capabilities
+	BindMount     Condition = "bind_mount"      // Bind mounts, optionally only of Paths or directories containing them
+	Devices       Condition = "devices"         // Host devices
+	NoMemoryLimit Condition = "no_memory_limit" // Creation without a memory limit
+)
+
+var conditions = []Condition{Any, Privileged, HostNetwork, HostPID, CapAdd, BindMount, Devices, NoMemoryLimit}
+
+// Rule is one entry of the rule file.
+type Rule struct {
+	Name         string    `yaml:"name"`
+	Match        Condition `yaml:"match"`
+	Action       Action    `yaml:"action"`
+	Message      string    `yaml:"message"`      // Replaces the generated reason
+	Kinds        []Kind    `yaml:"kinds"`        // Request kinds the rule applies to; all when empty
+	Paths        []string  `yaml:"paths"`        // bind_mount: host paths or path.Match patterns
+	Capabilities []string  `yaml:"capabilities"` // cap_add: capabilities that count, such as SYS_ADMIN or ALL
+	Set          Set       `yaml:"set"`          // mutate: the changes to make
+}
+
+// Set lists the changes a mutate rule makes. Unset fields are left alone.
+type Set struct {
+	Memory      string `yaml:"memory"`       // Memory limit, such as "512M"
+	PidsLimit   int64  `yaml:"pids_limit"`   // Process limit
+	Privileged  *bool  `yaml:"privileged"`   // Only false is allowed
+	DropCapAdd  bool   `yaml:"drop_cap_add"` // Remove the added capabilities
+	memoryBytes int64
+}
+
+// Policy is a parsed rule file. A nil *Policy allows everything.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Violation is a rule that matched a request.
+type Violation struct {
+	Rule   string `json:"rule"`
+	Action Action `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// Decision is the outcome of evaluating a request.
+type Decision struct {
+	Denied    *Violation  // The first deny rule that matched; nil when allowed
+	Warnings  []Violation // Warn rules that matched
+	Mutations []Violation // Mutate rules that rewrote the request
+}
+
+// Load reads and validates the rule file. Errors name the offending rule,
+// for example "rules[2].action: ...".
+func Load(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("policy file: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", filename, err)
+	}
+	return p, nil
+}
+
+// Parse parses and validates rules in YAML or JSON.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("rules[%d]%s", i, err)
+		}
+	}
+	return p, nil
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf(".name: missing")
+	}
+	if !slices.Contains(conditions, r.Match) {
+		return fmt.Errorf(" (%s).match: unknown condition %q", r.Name, r.Match)
+	}
+	for _, kind := range r.Kinds {
+		if !slices.Contains(kinds, kind) {
+			return fmt.Errorf(" (%s).kinds: unknown kind %q, expected container, container_update or service", r.Name, kind)
+		}
+	}
+	for i, pattern := range r.Paths {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf(" (%s).paths: invalid path %q", r.Name, pattern)
+		}
+		r.Paths[i] = canonicalPath(pattern)
+	}
+	for i, capability := range r.Capabilities {
+		r.Capabilities[i] = normalizeCapability(capability)
+	}
+	switch r.Action {
+	case Deny, Warn:
+	case Mutate:
+		if r.Set.Memory != "" {
+			n, err := config.ParseSize(r.Set.Memory)
+			if err != nil || n == 0 {
+				return fmt.Errorf(" (%s).set.memory: invalid size %q", r.Name, r.Set.Memory)
+			}
+			r.Set.memoryBytes = n
+		}
+		if r.Set.PidsLimit < 0 {
+			return fmt.Errorf(" (%s).set.pids_limit: invalid limit %d", r.Name, r.Set.PidsLimit)
+		}
+		if r.Set.Privileged != nil && *r.Set.Privileged {
+			return fmt.Errorf(" (%s).set.privileged: only false is allowed", r.Name)
+		}
+		if r.Set == (Set{}) {
+			return fmt.Errorf(" (%s).set: nothing to change", r.Name)
+		}
+	default:
+		return fmt.Errorf(" (%s).action: %q is not one of deny, warn or mutate", r.Name, r.Action)
+	}
+	return nil
+}
+
+// Evaluate applies the rules in order to the arguments of a tool call of
+// the given kind. It returns the arguments to send, with the fields the
+// rules read under their API names and rewritten by mutate rules, and the
+// decision. Evaluation stops at the first deny. Arguments that spell one
+// field in two ways are denied.
+func (p *Policy) Evaluate(kind Kind, args map[string]any) (map[string]any, Decision) {
+	var d Decision
+	if p == nil {
+		return args, d
+	}
+	canonical, err := canonicalize(schemas[kind], args)
+	if err != nil {
+		d.Denied = &Violation{Rule: "arguments", Action: Deny, Reason: err.Error()}
+		return args, d
+	}
+	args, _ = canonical.(map[string]any)
+	for _, rule := range p.Rules {
+		if len(rule.Kinds) > 0 && !slices.Contains(rule.Kinds, kind) {
+			continue
+		}
+		req := normalize(kind, args)
+		reason, ok := rule.matches(req)
+		if !ok {
+			continue
+		}
+		if rule.Message != "" {
+			reason = rule.Message
+		}
+		v := Violation{Rule: rule.Name, Action: rule.Action, Reason: reason}
+		switch rule.Action {
+		case Deny:
+			d.Denied = &v
+			return args, d
+		case Warn:
+			d.Warnings = append(d.Warnings, v)
+		case Mutate:
+			var changes []string
+			args, changes = rule.Set.apply(kind, args)
+			if len(changes) == 0 {
+				continue
+			}
+			if rule.Message == "" {
+				v.Reason = reason + ": " + strings.Join(changes, ", ")
+			}
+			d.Mutations = append(d.Mutations, v)
+		}
+	}
+	return args, d
+}
+
+// matches reports whether the rule's condition holds for req, with a reason
+// describing what matched.
+func (r *Rule) matches(req request) (string, bool) {
+	switch r.Match {
+	case Any:
+		return "applies to every request", true
+	case Privileged:
+		return "privileged mode is requested", req.privileged
+	case HostNetwork:
+		return "the host network is requested", req.hostNetwork
+	case HostPID:
+		return "the host PID namespace is requested", req.hostPID
+	case CapAdd:
+		var added []string
+		for _, capability := range req.capAdd {
+			if len(r.Capabilities) == 0 || slices.Contains(r.Capabilities, capability) {
+				added = append(added, capability)
+			}
+		}
+		return "capabilities are added: " + strings.Join(added, ", "), len(added) > 0
+	case BindMount:
+		var sources []string
+		for _, source := range req.binds {
+			if len(r.Paths) == 0 || exposes(source, r.Paths) {
+				sources = append(sources, source)
+			}
+		}
+		return "host paths are bind mounted: " + strings.Join(sources, ", "), len(sources) > 0
+	case Devices:
+		return "host devices are mapped: " + strings.Join(req.devices, ", "), len(req.devices) > 0
+	case NoMemoryLimit:
+		return "no memory limit is set", req.creates && req.memory <= 0
+	}
+	return "", false
+}
+
+// exposes reports whether bind mounting source gives access to one of the
+// protected paths: it is the path, matches the pattern, or contains it.
+func exposes(source string, protected []string) bool {
+	for _, p := range protected {
+		if ok, _ := path.Match(p, source); ok {
+			return true
+		}
+		if source == "/" || strings.HasPrefix(p, source+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(capability)), "CAP_")
+}
@@ -0,0 +1,186 @@
+package policy
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+const testRules = `
+rules:
+  - name: no-privileged
+    match: privileged
+    action: deny
+  - name: no-docker-socket
+    match: bind_mount
+    action: deny
+    paths: [/var/run/docker.sock]
+  - name: no-host-network
+    match: host_network
+    action: warn
+  - name: memory-limit
+    match: no_memory_limit
+    action: mutate
+    set:
+      memory: 512M
+`
+
+func mustParse(t *testing.T, rules string) *Policy {
+	t.Helper()
+	p, err := Parse([]byte(rules))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return p
+}
+
+func mustArgs(t *testing.T, body string) map[string]any {
+	t.Helper()
+	var args map[string]any
+	if err := json.Unmarshal([]byte(body), &args); err != nil {
+		t.Fatalf("bad test arguments %s: %v", body, err)
+	}
+	return args
+}
+
+func TestEvaluate(t *testing.T) {
+	p := mustParse(t, testRules)
+	limited := `"Memory":1073741824`
+	tests := []struct {
+		name     string
+		kind     Kind
+		args     string
+		denied   string // Rule of the denial, empty when allowed
+		warnings []string
+		mutated  []string
+	}{
+		{"plain container", KindContainer, `{"Image":"nginx","HostConfig":{` + limited + `}}`, "", nil, nil},
+		{"privileged", KindContainer, `{"HostConfig":{"Privileged":true}}`, "no-privileged", nil, nil},
+		{"lowercase privileged", KindContainer, `{"hostconfig":{"privileged":true}}`, "no-privileged", nil, nil},
+		{"mixed case privileged", KindContainer, `{"hostConfig":{"PRIVILEGED":true}}`, "no-privileged", nil, nil},
+		{"socket bind", KindContainer, `{"HostConfig":{"Binds":["/var/run/docker.sock:/s"]}}`, "no-docker-socket", nil, nil},
+		{"lowercase root bind", KindContainer, `{"hostconfig":{"binds":["/:/host"],` + limited + `}}`, "no-docker-socket", nil, nil},
+		{"socket through /run", KindContainer, `{"HostConfig":{"Binds":["/run/docker.sock:/s"]}}`, "no-docker-socket", nil, nil},
+		{"socket with trailing slash", KindContainer, `{"HostConfig":{"Binds":["/var/run/docker.sock/:/s"]}}`, "no-docker-socket", nil, nil},
+		{"socket through ..", KindContainer, `{"HostConfig":{"Binds":["/var/lib/../run/docker.sock:/s"]}}`, "no-docker-socket", nil, nil},
+		{"socket directory mount", KindContainer, `{"HostConfig":{"mounts":[{"type":"BIND","source":"/run/"}]}}`, "no-docker-socket", nil, nil},
+		{"other bind", KindContainer, `{"HostConfig":{"Binds":["/srv/data:/data"],` + limited + `}}`, "", nil, nil},
+		{"named volume", KindContainer, `{"HostConfig":{"Binds":["data:/var/run"],` + limited + `}}`, "", nil, nil},
+		{"host network warns", KindContainer, `{"HostConfig":{"networkmode":"host",` + limited + `}}`, "", []string{"no-host-network"}, nil},
+		{"no memory limit", KindContainer, `{"Image":"nginx"}`, "", nil, []string{"memory-limit"}},
+		{"ambiguous fields", KindContainer, `{"HostConfig":{` + limited + `},"hostconfig":{"Privileged":true}}`, "arguments", nil, nil},
+		{"update without limit", KindContainerUpdate, `{"CpuShares":512}`, "", nil, nil},
+		{"service socket mount", KindService, `{"TaskTemplate":{"ContainerSpec":{"Mounts":[{"Type":"bind","Source":"/var/run/docker.sock"}]}}}`, "no-docker-socket", nil, nil},
+		{"lowercase service host network", KindService, `{"tasktemplate":{"networks":[{"target":"host"}],"resources":{"limits":{"memorybytes":1}}}}`, "", []string{"no-host-network"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, d := p.Evaluate(tt.kind, mustArgs(t, tt.args))
+			denied := ""
+			if d.Denied != nil {
+				denied = d.Denied.Rule
+			}
+			if denied != tt.denied {
+				t.Errorf("denied by %q, want %q (decision %+v)", denied, tt.denied, d)
+			}
+			if got := rules(d.Warnings); !slices.Equal(got, tt.warnings) {
+				t.Errorf("warnings %v, want %v", got, tt.warnings)
+			}
+			if got := rules(d.Mutations); !slices.Equal(got, tt.mutated) {
+				t.Errorf("mutations %v, want %v", got, tt.mutated)
+			}
+		})
+	}
+}
+
+func rules(violations []Violation) []string {
+	var names []string
+	for _, v := range violations {
+		names = append(names, v.Rule)
+	}
+	return names
+}
+
+func TestEvaluateRewritesCanonicalArguments(t *testing.T) {
+	p := mustParse(t, `
+rules:
+  - name: drop-privileges
+    match: privileged
+    action: mutate
+    set:
+      privileged: false
+      memory: 256M
+`)
+	args := mustArgs(t, `{"Image":"nginx","hostconfig":{"privileged":true}}`)
+	got, d := p.Evaluate(KindContainer, args)
+	if len(d.Mutations) != 1 {
+		t.Fatalf("mutations %+v, want one", d.Mutations)
+	}
+	want := mustArgs(t, `{"Image":"nginx","HostConfig":{"Privileged":false,"Memory":268435456}}`)
+	want["HostConfig"].(map[string]any)["Memory"] = int64(268435456)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("arguments %v, want %v", got, want)
+	}
+	if args["hostconfig"].(map[string]any)["privileged"] != true {
+		t.Errorf("caller's arguments were changed: %v", args)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		kind Kind
+		args string
+		want request
+	}{
+		{"container", KindContainer,
+			`{"HostConfig":{"Privileged":true,"PidMode":"host","CapAdd":["cap_sys_admin"],"Binds":["/var/run/docker.sock:/s:ro","vol:/v"],"Devices":[{"PathOnHost":"/dev/fuse"}],"Memory":64}}`,
+			request{creates: true, privileged: true, hostPID: true, capAdd: []string{"SYS_ADMIN"}, binds: []string{"/run/docker.sock"}, devices: []string{"/dev/fuse"}, memory: 64}},
+		{"update", KindContainerUpdate, `{"Devices":[{"PathOnHost":"/dev/kvm/"}],"Memory":8}`,
+			request{devices: []string{"/dev/kvm"}, memory: 8}},
+		{"service", KindService,
+			`{"TaskTemplate":{"ContainerSpec":{"CapabilityAdd":["NET_ADMIN"],"Mounts":[{"Type":"bind","Source":"/etc/"},{"Type":"volume","Source":"v"}]},"Resources":{"Limits":{"MemoryBytes":32}}},"Networks":[{"Target":"host"}]}`,
+			request{creates: true, hostNetwork: true, capAdd: []string{"NET_ADMIN"}, binds: []string{"/etc"}, memory: 32}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalize(tt.kind, mustArgs(t, tt.args))
+			if len(got.capAdd) == 0 {
+				got.capAdd = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalize = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"/var/run/docker.sock":           "/run/docker.sock",
+		"/var/run/":                      "/run",
+		"/var/runner":                    "/var/runner",
+		"/srv//data/./x/../y/":           "/srv/data/y",
+		"/var/lib/../run/docker.sock":    "/run/docker.sock",
+		"/var/run/../lib/docker/volumes": "/var/lib/docker/volumes",
+	} {
+		if got := canonicalPath(in); got != want {
+			t.Errorf("canonicalPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"rules:\n  - match: any\n    action: deny\n":                                       "rules[0].name: missing",
+		"rules:\n  - name: x\n    match: nope\n    action: deny\n":                         `rules[0] (x).match: unknown condition "nope"`,
+		"rules:\n  - name: x\n    match: any\n    action: mutate\n":                        "rules[0] (x).set: nothing to change",
+		"rules:\n  - name: x\n    match: bind_mount\n    action: deny\n    paths: [etc]\n": `rules[0] (x).paths: invalid path "etc"`,
+	}
+	for rules, want := range tests {
+		if _, err := Parse([]byte(rules)); err == nil || err.Error() != want {
+			t.Errorf("Parse(%q) error %v, want %q", rules, err, want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Kind is the shape of the arguments a tool takes.
+type Kind string
+
+const (
+	KindContainer       Kind = "container"        // post_containers_create: Config with a HostConfig
+	KindContainerUpdate Kind = "container_update" // post_containers_id_update: resources at the top level
+	KindService         Kind = "service"          // post_services_create and post_services_id_update: a ServiceSpec
+)
+
+var kinds = []Kind{KindContainer, KindContainerUpdate, KindService}
+
+// KindOf returns the kind of the arguments of the named tool, false for
+// tools the policy does not apply to.
+func KindOf(tool string) (Kind, bool) {
+	switch tool {
+	case "post_containers_create":
+		return KindContainer, true
+	case "post_containers_id_update":
+		return KindContainerUpdate, true
+	case "post_services_create", "post_services_id_update":
+		return KindService, true
+	}
+	return "", false
+}
+
+// schema lists the fields the policy reads under their names in the Engine
+// API, with the fields of the objects (or lists of objects) they hold.
+type schema map[string]schema
+
+var mountSchema = schema{"Type": nil, "Source": nil}
+var deviceSchema = schema{"PathOnHost": nil}
+var networkSchema = schema{"Target": nil}
+
+var schemas = map[Kind]schema{
+	KindContainer: {"HostConfig": {
+		"Privileged": nil, "NetworkMode": nil, "PidMode": nil, "CapAdd": nil, "Binds": nil,
+		"Mounts": mountSchema, "Devices": deviceSchema, "Memory": nil, "PidsLimit": nil,
+	}},
+	KindContainerUpdate: {"Devices": deviceSchema, "Memory": nil, "PidsLimit": nil},
+	KindService: {
+		"TaskTemplate": {
+			"ContainerSpec": {"CapabilityAdd": nil, "Mounts": mountSchema},
+			"Networks":      networkSchema,
+			"Resources":     {"Limits": {"MemoryBytes": nil, "Pids": nil}},
+		},
+		"Networks": networkSchema,
+	},
+}
+
+// canonicalize returns a copy of v with the fields of s renamed to their API
+// names. The daemon decodes field names without regard to case, so
+// "hostconfig" must be checked like "HostConfig". Two spellings of one field
+// are refused, since which one the daemon uses is not obvious.
+func canonicalize(s schema, v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			name, child := k, schema(nil)
+			for field, fields := range s {
+				if strings.EqualFold(field, k) {
+					name, child = field, fields
+					break
+				}
+			}
+			if _, dup := out[name]; dup {
+				return nil, fmt.Errorf("field %s is given more than once with different case", name)
+			}
+			val, err := canonicalize(child, val)
+			if err != nil {
+				return nil, err
+			}
+			out[name] = val
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			val, err := canonicalize(s, val)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// canonicalPath cleans p, so trailing slashes and ".." do not hide a path,
+// and spells /var/run, a link to /run, as /run.
+func canonicalPath(p string) string {
+	p = path.Clean(p)
+	if p == "/var/run" || strings.HasPrefix(p, "/var/run/") {
+		p = strings.TrimPrefix(p, "/var")
+	}
+	return p
+}
+
+// request is what the rules look at, taken from the arguments of any kind.
+type request struct {
+	creates     bool // Updates leave unset limits unchanged
+	privileged  bool
+	hostNetwork bool
+	hostPID     bool
+	capAdd      []string
+	binds       []string // Host paths
+	devices     []string // Host device paths
+	memory      int64
+}
+
+func normalize(kind Kind, args map[string]any) request {
+	var req request
+	switch kind {
+	case KindContainer:
+		req.creates = true
+		host := object(args, "HostConfig")
+		req.privileged, _ = host["Privileged"].(bool)
+		req.hostNetwork = isHost(host["NetworkMode"])
+		req.hostPID = isHost(host["PidMode"])
+		req.capAdd = capabilities(host["CapAdd"])
+		for _, bind := range stringList(host["Binds"]) {
+			// "source:target[:options]"; sources that are not absolute paths name volumes.
+			if source, _, _ := strings.Cut(bind, ":"); strings.HasPrefix(source, "/") {
+				req.binds = append(req.binds, canonicalPath(source))
+			}
+		}
+		req.binds = append(req.binds, bindMounts(host["Mounts"])...)
+		req.devices = devices(host["Devices"])
+		req.memory = number(host["Memory"])
+	case KindContainerUpdate:
+		req.devices = devices(args["Devices"])
+		req.memory = number(args["Memory"])
+	case KindService:
+		req.creates = true
+		task := object(args, "TaskTemplate")
+		spec := object(task, "ContainerSpec")
+		req.capAdd = capabilities(spec["CapabilityAdd"])
+		req.binds = bindMounts(spec["Mounts"])
+		networks, _ := task["Networks"].([]any)
+		if top, ok := args["Networks"].([]any); ok {
+			networks = append(networks, top...)
+		}
+		for _, n := range networks {
+			if n, ok := n.(map[string]any); ok && isHost(n["Target"]) {
+				req.hostNetwork = true
+			}
+		}
+		req.memory = number(object(object(task, "Resources"), "Limits")["MemoryBytes"])
+	}
+	return req
+}
+
+// apply makes the changes of s to a copy of args and describes them.
+// Changes that do not apply to the kind, or are already in place, are
+// skipped.
+func (s Set) apply(kind Kind, args map[string]any) (map[string]any, []string) {
+	if kind == KindContainerUpdate {
+		// An update only changes what it names; adding limits to it would
+		// change a running container the caller did not ask about.
+		return args, nil
+	}
+	args = clone(args).(map[string]any)
+	var changes []string
+	// target is where the settings live: the HostConfig, or the container
+	// spec and its resource limits in a service.
+	var target, limits map[string]any
+	capKey, memKey, pidsKey := "CapAdd", "Memory", "PidsLimit"
+	if kind == KindContainer {
+		target = ensure(args, "HostConfig")
+		limits = target
+	} else {
+		task := ensure(args, "TaskTemplate")
+		target = ensure(task, "ContainerSpec")
+		limits = ensure(ensure(task, "Resources"), "Limits")
+		capKey, memKey, pidsKey = "CapabilityAdd", "MemoryBytes", "Pids"
+	}
+	if s.memoryBytes > 0 && number(limits[memKey]) <= 0 {
+		limits[memKey] = s.memoryBytes
+		changes = append(changes, fmt.Sprintf("memory limit set to %d bytes", s.memoryBytes))
+	}
+	if s.PidsLimit > 0 && number(limits[pidsKey]) <= 0 {
+		limits[pidsKey] = s.PidsLimit
+		changes = append(changes, fmt.Sprintf("pids limit set to %d", s.PidsLimit))
+	}
+	if s.Privileged != nil && kind == KindContainer && target["Privileged"] == true {
+		target["Privileged"] = false
+		changes = append(changes, "privileged mode removed")
+	}
+	if s.DropCapAdd && len(capabilities(target[capKey])) > 0 {
+		delete(target, capKey)
+		changes = append(changes, "added capabilities removed")
+	}
+	return args, changes
+}
+
+// object returns the object at key, or an empty one.
+func object(m map[string]any, key string) map[string]any {
+	if obj, ok := m[key].(map[string]any); ok {
+		return obj
+	}
+	return map[string]any{}
+}
+
+// ensure returns the object at key, adding it when missing.
+func ensure(m map[string]any, key string) map[string]any {
+	obj, ok := m[key].(map[string]any)
+	if !ok {
+		obj = map[string]any{}
+		m[key] = obj
+	}
+	return obj
+}
+
+// clone deep-copies a value decoded from JSON, so mutations leave the
+// caller's arguments alone.
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[k] = clone(val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = clone(val)
+		}
+		return out
+	}
+	return v
+}
+
+func isHost(v any) bool {
+	s, _ := v.(string)
+	return strings.EqualFold(s, "host")
+}
+
+func number(v any) int64 {
+	switch v := v.(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	}
+	return 0
+}
+
+func stringList(v any) []string {
+	list, _ := v.([]any)
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func capabilities(v any) []string {
+	caps := stringList(v)
+	for i, capability := range caps {
+		caps[i] = normalizeCapability(capability)
+	}
+	return caps
+}
+
+// bindMounts returns the host paths of the bind mounts in a Mounts list.
+func bindMounts(v any) []string {
+	var sources []string
+	list, _ := v.([]any)
+	for _, item := range list {
+		m, ok := item.(map[string]any)
+		if typ, _ := m["Type"].(string); !ok || !strings.EqualFold(typ, "bind") {
+			continue
+		}
+		if source, ok := m["Source"].(string); ok {
+			sources = append(sources, canonicalPath(source))
+		}
+	}
+	return sources
+}
+
+func devices(v any) []string {
+	var paths []string
+	list, _ := v.([]any)
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			if p, ok := m["PathOnHost"].(string); ok {
+				paths = append(paths, canonicalPath(p))
+			}
+		}
+	}
+	return paths
+}
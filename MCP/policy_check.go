@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/docker-engine-api/mcp-server/policy"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// loadPolicy reads the rule file named by POLICY_FILE, nil when it is not set.
+func loadPolicy(filename string) (*policy.Policy, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	return policy.Load(filename)
+}
+
+// withPolicy checks the containers and services that tools create or update
+// against the rule file. Denied calls return the rule and reason; warnings
+// and rewrites are reported after the daemon's answer.
+func withPolicy(pol *policy.Policy) toolMiddleware {
+	return func(tool models.Tool) models.Tool {
+		kind, ok := policy.KindOf(tool.Definition.Name)
+		if pol == nil || !ok {
+			return tool
+		}
+		name := tool.Definition.Name
+		next := tool.Handler
+		tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args, decision := pol.Evaluate(kind, request.GetArguments())
+			if denied := decision.Denied; denied != nil {
+				log.Printf("Refused %s: policy rule %s: %s%s", name, denied.Rule, denied.Reason, clientSuffix(ctx))
+				result := mcp.NewToolResultStructured(map[string]any{
+					"error":  "policy_denied",
+					"rule":   denied.Rule,
+					"reason": denied.Reason,
+				}, fmt.Sprintf("denied by policy rule %s: %s", denied.Rule, denied.Reason))
+				result.IsError = true
+				return result, nil
+			}
+			for _, v := range decision.Mutations {
+				log.Printf("Policy rule %s rewrote %s: %s%s", v.Rule, name, v.Reason, clientSuffix(ctx))
+			}
+			// Send the arguments as checked, with the fields the rules read
+			// under their API names.
+			request.Params.Arguments = args
+			result, err := next(ctx, request)
+			if result == nil {
+				return result, err
+			}
+			for _, v := range append(decision.Mutations, decision.Warnings...) {
+				result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Policy %s (%s): %s", v.Action, v.Rule, v.Reason)))
+			}
+			return result, err
+		}
+		return tool
+	}
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/docker-engine-api/mcp-server/config"
+)
+
+// previewers describe what each destructive tool would affect.
+var previewers = map[string]previewer{
+	"delete_containers_id":  previewContainerDelete,
+	"delete_images_name":    previewImageDelete,
+	"delete_volumes_name":   previewVolumeDelete,
+	"delete_networks_id":    previewNetworkDelete,
+	"delete_nodes_id":       previewNodeDelete,
+	"delete_services_id":    previewServiceDelete,
+	"delete_secrets_id":     previewSwarmObjectDelete("secrets"),
+	"delete_configs_id":     previewSwarmObjectDelete("configs"),
+	"delete_plugins_name":   previewPluginDelete,
+	"post_containers_prune": previewContainerPrune,
+	"post_images_prune":     previewImagePrune,
+	"post_volumes_prune":    previewVolumePrune,
+	"post_networks_prune":   previewNetworkPrune,
+	"post_build_prune":      previewBuildPrune,
+	"post_swarm_leave":      previewSwarmLeave,
+}
+
+// containerSummary is a container as listed by /containers/json.
+type containerSummary struct {
+	ID      string   `json:"Id"`
+	Names   []string `json:"Names"`
+	Image   string   `json:"Image"`
+	ImageID string   `json:"ImageID"`
+	State   string   `json:"State"`
+	Status  string   `json:"Status"`
+	SizeRw  int64    `json:"SizeRw"`
+
+	NetworkSettings struct {
+		Networks map[string]struct {
+			NetworkID string `json:"NetworkID"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+func (c containerSummary) brief() map[string]any {
+	return map[string]any{"Id": shortID(c.ID), "Names": c.Names, "Image": c.Image, "State": c.State}
+}
+
+// containersWith lists every container matching filters.
+func containersWith(ctx context.Context, cfg *config.APIConfig, filters map[string][]string, size bool) ([]containerSummary, error) {
+	query := filterQuery(filters)
+	query.Set("all", "1")
+	if size {
+		query.Set("size", "1")
+	}
+	var containers []containerSummary
+	err := daemonGet(ctx, cfg, "/containers/json", query, &containers)
+	return containers, err
+}
+
+func argString(args map[string]any, name string) (string, error) {
+	val, ok := args[name].(string)
+	if !ok || val == "" {
+		return "", fmt.Errorf("missing required parameter: %s", name)
+	}
+	return val, nil
+}
+
+func argBool(args map[string]any, name string) bool {
+	val, _ := args[name].(bool)
+	return val
+}
+
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func total(p *preview, size int64) {
+	p.TotalSize = &size
+}
+
+// anonymousVolumeRE matches the names the daemon generates for anonymous volumes.
+var anonymousVolumeRE = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func previewContainerDelete(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	id, err := argString(args, "id")
+	if err != nil {
+		return err
+	}
+	var c struct {
+		ID     string `json:"Id"`
+		Name   string `json:"Name"`
+		Config struct {
+			Image string `json:"Image"`
+		} `json:"Config"`
+		State struct {
+			Status  string `json:"Status"`
+			Running bool   `json:"Running"`
+		} `json:"State"`
+		Mounts []struct {
+			Type        string `json:"Type"`
+			Name        string `json:"Name,omitempty"`
+			Source      string `json:"Source"`
+			Destination string `json:"Destination"`
+		} `json:"Mounts"`
+	}
+	if err := daemonGet(ctx, cfg, "/containers/"+url.PathEscape(id)+"/json", nil, &c); err != nil {
+		return err
+	}
+	p.Affected = append(p.Affected, map[string]any{"Id": shortID(c.ID), "Name": c.Name, "Image": c.Config.Image, "State": c.State.Status, "Mounts": c.Mounts})
+	if c.State.Running && !argBool(args, "force") {
+		p.Warnings = append(p.Warnings, "the container is running; removing it fails unless force is true")
+	}
+	if argBool(args, "v") {
+		// v removes only anonymous volumes; named ones are kept.
+		for _, m := range c.Mounts {
+			if m.Type == "volume" && anonymousVolumeRE.MatchString(m.Name) {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("v is true: anonymous volume %s mounted at %s is removed too", m.Name, m.Destination))
+			}
+		}
+	}
+	return nil
+}
+
+func previewImageDelete(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	name, err := argString(args, "name")
+	if err != nil {
+		return err
+	}
+	var image struct {
+		ID       string   `json:"Id"`
+		RepoTags []string `json:"RepoTags"`
+		Size     int64    `json:"Size"`
+	}
+	if err := daemonGet(ctx, cfg, "/images/"+url.PathEscape(name)+"/json", nil, &image); err != nil {
+		return err
+	}
+	users, err := containersWith(ctx, cfg, map[string][]string{"ancestor": {name}}, false)
+	if err != nil {
+		return err
+	}
+	usedBy := make([]any, 0, len(users))
+	for _, c := range users {
+		usedBy = append(usedBy, c.brief())
+	}
+	p.Affected = append(p.Affected, map[string]any{"Id": shortID(image.ID), "RepoTags": image.RepoTags, "Size": image.Size, "UsedBy": usedBy})
+	total(p, image.Size)
+	if len(users) > 0 && !argBool(args, "force") {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("%d containers use this image; removing it fails unless force is true", len(users)))
+	}
+	if len(image.RepoTags) > 1 {
+		p.Warnings = append(p.Warnings, "the image has several tags; removing one tag only untags it")
+	}
+	return nil
+}
+
+// volumeUsage holds the volumes reported by /system/df.
+type volumeUsage struct {
+	Volumes []struct {
+		Name       string            `json:"Name"`
+		Driver     string            `json:"Driver"`
+		Mountpoint string            `json:"Mountpoint"`
+		Labels     map[string]string `json:"Labels"`
+		UsageData  *struct {
+			Size     int64 `json:"Size"`
+			RefCount int64 `json:"RefCount"`
+		} `json:"UsageData"`
+	} `json:"Volumes"`
+}
+
+func previewVolumeDelete(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	name, err := argString(args, "name")
+	if err != nil {
+		return err
+	}
+	var volume struct {
+		Name       string `json:"Name"`
+		Driver     string `json:"Driver"`
+		Mountpoint string `json:"Mountpoint"`
+		CreatedAt  string `json:"CreatedAt"`
+	}
+	if err := daemonGet(ctx, cfg, "/volumes/"+url.PathEscape(name), nil, &volume); err != nil {
+		return err
+	}
+	users, err := containersWith(ctx, cfg, map[string][]string{"volume": {name}}, false)
+	if err != nil {
+		return err
+	}
+	usedBy := make([]any, 0, len(users))
+	for _, c := range users {
+		usedBy = append(usedBy, c.brief())
+	}
+	entry := map[string]any{"Name": volume.Name, "Driver": volume.Driver, "Mountpoint": volume.Mountpoint, "CreatedAt": volume.CreatedAt, "UsedBy": usedBy}
+	var df volumeUsage
+	if err := daemonGet(ctx, cfg, "/system/df", url.Values{"type": {"volume"}}, &df); err == nil {
+		for _, v := range df.Volumes {
+			if v.Name == volume.Name && v.UsageData != nil && v.UsageData.Size >= 0 {
+				entry["Size"] = v.UsageData.Size
+				total(p, v.UsageData.Size)
+			}
+		}
+	}
+	p.Affected = append(p.Affected, entry)
+	if len(users) > 0 {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("%d containers use this volume; removing it fails while they exist", len(users)))
+	}
+	return nil
+}
+
+func previewNetworkDelete(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	id, err := argString(args, "id")
+	if err != nil {
+		return err
+	}
+	var network struct {
+		ID         string `json:"Id"`
+		Name       string `json:"Name"`
+		Driver     string `json:"Driver"`
+		Scope      string `json:"Scope"`
+		Containers map[string]struct {
+			Name string `json:"Name"`
+		} `json:"Containers"`
+	}
+	if err := daemonGet(ctx, cfg, "/networks/"+url.PathEscape(id), nil, &network); err != nil {
+		return err
+	}
+	connected := make([]string, 0, len(network.Containers))
+	for _, c := range network.Containers {
+		connected = append(connected, c.Name)
+	}
+	slices.Sort(connected)
+	p.Affected = append(p.Affected, map[string]any{"Id": shortID(network.ID), "Name": network.Name, "Driver": network.Driver, "Scope": network.Scope, "Containers": connected})
+	if len(connected) > 0 {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("%d containers are connected; removing the network fails until they are disconnected", len(connected)))
+	}
+	return nil
+}
+
+func previewNodeDelete(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	id, err := argString(args, "id")
+	if err != nil {
+		return err
+	}
+	var node struct {
+		ID          string `json:"ID"`
+		Description struct {
+			Hostname string `json:"Hostname"`
+		} `json:"Description"`
+		Spec struct {
+			Role         string `json:"Role"`
+			Availability string `json:"Availability"`
+		} `json:"Spec"`
+		Status struct {
+			State string `json:"State"`
+		} `json:"Status"`
+		ManagerStatus *struct {
+			Leader bool `json:"Leader"`
+		} `json:"ManagerStatus"`
+	}
+	if err := daemonGet(ctx, cfg, "/nodes/"+url.PathEscape(id), nil, &node); err != nil {
+		return err
+	}
+	var tasks []struct {
+		ID string `json:"ID"`
+	}
+	filters := map[string][]string{"node": {node.ID}, "desired-state": {"running"}}
+	if err := daemonGet(ctx, cfg, "/tasks", filterQuery(filters), &tasks); err != nil {
+		return err
+	}
+	p.Affected = append(p.Affected, map[string]any{"ID": node.ID, "Hostname": node.Description.Hostname, "Role": node.Spec.Role, "Availability": node.Spec.Availability, "State": node.Status.State, "RunningTasks": len(tasks)})
+	if node.Spec.Role == "manager" {
+		p.Warnings = append(p.Warnings, "the node is a manager; demote it first")
+	}
+	if node.Status.State != "down" && !argBool(args, "force") {
+		p.Warnings = append(p.Warnings, "the node is not down; removing it fails unless force is true")
+	}
+	return nil
+}
+
+// serviceSummary is a service as listed by /services.
+type serviceSummary struct {
+	ID   string `json:"ID"`
+	Spec struct {
+		Name         string `json:"Name"`
+		TaskTemplate struct {
+			ContainerSpec struct {
+				Image   string `json:"Image"`
+				Secrets []struct {
+					SecretID   string `json:"SecretID"`
+					SecretName string `json:"SecretName"`
+				} `json:"Secrets"`
+				Configs []struct {
+					ConfigID   string `json:"ConfigID"`
+					ConfigName string `json:"ConfigName"`
+				} `json:"Configs"`
+			} `json:"ContainerSpec"`
+		} `json:"TaskTemplate"`
+	} `json:"Spec"`
+}
+
+func previewServiceDelete(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	id, err := argString(args, "id")
+	if err != nil {
+		return err
+	}
+	var service serviceSummary
+	if err := daemonGet(ctx, cfg, "/services/"+url.PathEscape(id), nil, &service); err != nil {
+		return err
+	}
+	var tasks []struct {
+		Status struct {
+			State string `json:"State"`
+		} `json:"Status"`
+	}
+	if err := daemonGet(ctx, cfg, "/tasks", filterQuery(map[string][]string{"service": {service.ID}}), &tasks); err != nil {
+		return err
+	}
+	running := 0
+	for _, task := range tasks {
+		if task.Status.State == "running" {
+			running++
+		}
+	}
+	p.Affected = append(p.Affected, map[string]any{"ID": service.ID, "Name": service.Spec.Name, "Image": service.Spec.TaskTemplate.ContainerSpec.Image, "RunningTasks": running})
+	return nil
+}
+
+// previewSwarmObjectDelete previews deleting a secret or config, listing
+// the services that use it.
+func previewSwarmObjectDelete(kind string) previewer {
+	return func(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+		id, err := argString(args, "id")
+		if err != nil {
+			return err
+		}
+		var object struct {
+			ID        string `json:"ID"`
+			CreatedAt string `json:"CreatedAt"`
+			Spec      struct {
+				Name string `json:"Name"`
+			} `json:"Spec"`
+		}
+		if err := daemonGet(ctx, cfg, "/"+kind+"/"+url.PathEscape(id), nil, &object); err != nil {
+			return err
+		}
+		var services []serviceSummary
+		if err := daemonGet(ctx, cfg, "/services", nil, &services); err != nil {
+			return err
+		}
+		usedBy := []string{}
+		for _, s := range services {
+			spec := s.Spec.TaskTemplate.ContainerSpec
+			for _, ref := range spec.Secrets {
+				if kind == "secrets" && ref.SecretID == object.ID {
+					usedBy = append(usedBy, s.Spec.Name)
+				}
+			}
+			for _, ref := range spec.Configs {
+				if kind == "configs" && ref.ConfigID == object.ID {
+					usedBy = append(usedBy, s.Spec.Name)
+				}
+			}
+		}
+		p.Affected = append(p.Affected, map[string]any{"ID": object.ID, "Name": object.Spec.Name, "CreatedAt": object.CreatedAt, "UsedByServices": usedBy})
+		if len(usedBy) > 0 {
+			p.Warnings = append(p.Warnings, fmt.Sprintf("%d services use it; removing it fails while they do", len(usedBy)))
+		}
+		return nil
+	}
+}
+
+func previewPluginDelete(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	name, err := argString(args, "name")
+	if err != nil {
+		return err
+	}
+	var plugin struct {
+		ID      string `json:"Id"`
+		Name    string `json:"Name"`
+		Enabled bool   `json:"Enabled"`
+	}
+	if err := daemonGet(ctx, cfg, "/plugins/"+url.PathEscape(name)+"/json", nil, &plugin); err != nil {
+		return err
+	}
+	p.Affected = append(p.Affected, map[string]any{"Id": shortID(plugin.ID), "Name": plugin.Name, "Enabled": plugin.Enabled})
+	if plugin.Enabled && !argBool(args, "force") {
+		p.Warnings = append(p.Warnings, "the plugin is enabled; removing it fails unless force is true")
+	}
+	return nil
+}
+
+// labelFilters keeps the label filters of a prune, which the list endpoints
+// understand too, and warns about the others.
+func labelFilters(filters map[string][]string, p *preview) map[string][]string {
+	kept := map[string][]string{}
+	for key, values := range filters {
+		switch key {
+		case "label", "label!":
+			kept[key] = values
+		case "dangling", "all":
+		default:
+			p.Warnings = append(p.Warnings, fmt.Sprintf("the %s filter is not applied to this preview; the prune may remove fewer objects", key))
+		}
+	}
+	return kept
+}
+
+func previewContainerPrune(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	filters, err := pruneFilters(args)
+	if err != nil {
+		return err
+	}
+	list := labelFilters(filters, p)
+	list["status"] = []string{"created", "exited", "dead"}
+	containers, err := containersWith(ctx, cfg, list, true)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, c := range containers {
+		entry := c.brief()
+		entry["Status"] = c.Status
+		entry["SizeRw"] = c.SizeRw
+		p.Affected = append(p.Affected, entry)
+		size += c.SizeRw
+	}
+	total(p, size)
+	return nil
+}
+
+func previewImagePrune(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	filters, err := pruneFilters(args)
+	if err != nil {
+		return err
+	}
+	list := labelFilters(filters, p)
+	danglingOnly := true
+	if values := filters["dangling"]; len(values) > 0 && (values[0] == "false" || values[0] == "0") {
+		danglingOnly = false
+	}
+	if danglingOnly {
+		list["dangling"] = []string{"true"}
+	}
+	var images []struct {
+		ID       string   `json:"Id"`
+		RepoTags []string `json:"RepoTags"`
+		Size     int64    `json:"Size"`
+		Created  int64    `json:"Created"`
+	}
+	if err := daemonGet(ctx, cfg, "/images/json", filterQuery(list), &images); err != nil {
+		return err
+	}
+	containers, err := containersWith(ctx, cfg, nil, false)
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, c := range containers {
+		used[c.ImageID] = true
+	}
+	var size int64
+	for _, image := range images {
+		if used[image.ID] {
+			continue
+		}
+		p.Affected = append(p.Affected, map[string]any{"Id": shortID(image.ID), "RepoTags": image.RepoTags, "Size": image.Size, "Created": image.Created})
+		size += image.Size
+	}
+	total(p, size)
+	if len(p.Affected) > 0 {
+		p.Warnings = append(p.Warnings, "images share layers, so the space reclaimed may be less than the total size")
+	}
+	return nil
+}
+
+func previewVolumePrune(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	filters, err := pruneFilters(args)
+	if err != nil {
+		return err
+	}
+	labels := labelFilters(filters, p)
+	var named map[string]bool
+	if len(labels) > 0 {
+		// /system/df cannot filter, so match the labels with a volume list.
+		var list struct {
+			Volumes []struct {
+				Name string `json:"Name"`
+			} `json:"Volumes"`
+		}
+		if err := daemonGet(ctx, cfg, "/volumes", filterQuery(labels), &list); err != nil {
+			return err
+		}
+		named = map[string]bool{}
+		for _, v := range list.Volumes {
+			named[v.Name] = true
+		}
+	}
+	var df volumeUsage
+	if err := daemonGet(ctx, cfg, "/system/df", url.Values{"type": {"volume"}}, &df); err != nil {
+		return err
+	}
+	var size int64
+	for _, v := range df.Volumes {
+		if v.UsageData == nil || v.UsageData.RefCount != 0 {
+			continue
+		}
+		if named != nil && !named[v.Name] {
+			continue
+		}
+		p.Affected = append(p.Affected, map[string]any{"Name": v.Name, "Driver": v.Driver, "Mountpoint": v.Mountpoint, "Size": v.UsageData.Size})
+		size += max(v.UsageData.Size, 0)
+	}
+	total(p, size)
+	return nil
+}
+
+func previewNetworkPrune(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	filters, err := pruneFilters(args)
+	if err != nil {
+		return err
+	}
+	var networks []struct {
+		ID      string `json:"Id"`
+		Name    string `json:"Name"`
+		Driver  string `json:"Driver"`
+		Scope   string `json:"Scope"`
+		Ingress bool   `json:"Ingress"`
+	}
+	if err := daemonGet(ctx, cfg, "/networks", filterQuery(labelFilters(filters, p)), &networks); err != nil {
+		return err
+	}
+	containers, err := containersWith(ctx, cfg, nil, false)
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, c := range containers {
+		for _, n := range c.NetworkSettings.Networks {
+			used[n.NetworkID] = true
+		}
+	}
+	for _, n := range networks {
+		if used[n.ID] || n.Ingress || slices.Contains([]string{"bridge", "host", "none"}, n.Name) {
+			continue
+		}
+		p.Affected = append(p.Affected, map[string]any{"Id": shortID(n.ID), "Name": n.Name, "Driver": n.Driver, "Scope": n.Scope})
+	}
+	return nil
+}
+
+func previewBuildPrune(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	var df struct {
+		BuildCache []struct {
+			ID          string `json:"ID"`
+			Type        string `json:"Type"`
+			Description string `json:"Description"`
+			InUse       bool   `json:"InUse"`
+			Shared      bool   `json:"Shared"`
+			Size        int64  `json:"Size"`
+			LastUsedAt  string `json:"LastUsedAt"`
+		} `json:"BuildCache"`
+	}
+	if err := daemonGet(ctx, cfg, "/system/df", url.Values{"type": {"build-cache"}}, &df); err != nil {
+		return err
+	}
+	var size int64
+	for _, record := range df.BuildCache {
+		if record.InUse {
+			continue
+		}
+		p.Affected = append(p.Affected, map[string]any{"ID": shortID(record.ID), "Type": record.Type, "Description": record.Description, "Size": record.Size, "LastUsedAt": record.LastUsedAt})
+		if !record.Shared {
+			size += record.Size
+		}
+	}
+	total(p, size)
+	return nil
+}
+
+func previewSwarmLeave(ctx context.Context, cfg *config.APIConfig, args map[string]any, p *preview) error {
+	var info struct {
+		Name  string `json:"Name"`
+		Swarm struct {
+			NodeID           string `json:"NodeID"`
+			LocalNodeState   string `json:"LocalNodeState"`
+			ControlAvailable bool   `json:"ControlAvailable"`
+			Managers         int    `json:"Managers"`
+			Nodes            int    `json:"Nodes"`
+		} `json:"Swarm"`
+	}
+	if err := daemonGet(ctx, cfg, "/info", nil, &info); err != nil {
+		return err
+	}
+	swarm := info.Swarm
+	if swarm.LocalNodeState != "active" {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("the node is not part of an active swarm (state %q)", swarm.LocalNodeState))
+		return nil
+	}
+	role := "worker"
+	if swarm.ControlAvailable {
+		role = "manager"
+	}
+	p.Affected = append(p.Affected, map[string]any{"NodeID": swarm.NodeID, "Hostname": info.Name, "Role": role, "SwarmManagers": swarm.Managers, "SwarmNodes": swarm.Nodes})
+	if swarm.ControlAvailable {
+		if !argBool(args, "force") {
+			p.Warnings = append(p.Warnings, "the node is a manager; leaving fails unless force is true")
+		}
+		if swarm.Managers <= 1 {
+			p.Warnings = append(p.Warnings, "this is the last manager; leaving with force destroys the swarm")
+		} else if swarm.Managers <= 3 {
+			p.Warnings = append(p.Warnings, fmt.Sprintf("leaving reduces the managers from %d and may cost the swarm its quorum", swarm.Managers))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// Package ratelimit caps the rate and concurrency of tool calls globally, per
+// client and per tool category, so one runaway client cannot flood the daemon.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"golang.org/x/time/rate"
+)
+
+// Category groups tools that put a similar load on the daemon.
+type Category string
+
+const (
+	Read   Category = "read"   // Inspecting and listing
+	Mutate Category = "mutate" // Creating, changing and removing objects
+	Stream Category = "stream" // Long-running calls: logs, stats, events, pulls and pushes
+)
+
+// maxClients is the number of per-client buckets kept. Past it idle buckets
+// are dropped, and when none is idle the least recently used one.
+const maxClients = 1024
+
+// Error reports a call refused by a limit.
+type Error struct {
+	Scope      string // "global", "client" or the category
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rate limited by the %s limit, retry after %d s", e.Scope, e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds rounds RetryAfter up to whole seconds, at least one.
+func (e *Error) RetryAfterSeconds() int {
+	return max(1, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+type bucket struct {
+	scope    string
+	limit    config.Limit
+	tokens   *rate.Limiter // nil without a rate limit
+	inFlight int
+	limited  uint64
+	used     time.Time // Last call admitted or refused, for client buckets
+}
+
+func newBucket(scope string, limit config.Limit) *bucket {
+	b := &bucket{scope: scope, limit: limit}
+	if limit.Rate > 0 {
+		b.tokens = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+	}
+	return b
+}
+
+// idle reports whether dropping the bucket would lose no state.
+func (b *bucket) idle(now time.Time) bool {
+	return b.inFlight == 0 && (b.tokens == nil || b.tokens.TokensAt(now) >= float64(b.limit.Burst))
+}
+
+// Limiter enforces Limits. A nil *Limiter allows every call.
+type Limiter struct {
+	limits config.Limits
+
+	mu         sync.Mutex
+	global     *bucket
+	categories map[Category]*bucket
+	clients    map[string]*bucket
+}
+
+// New returns a limiter for limits, or nil when no limit is set.
+func New(limits config.Limits) *Limiter {
+	l := &Limiter{limits: limits, categories: make(map[Category]*bucket), clients: make(map[string]*bucket)}
+	enabled := false
+	for _, scope := range limits.Scopes() {
+		enabled = enabled || scope.Limit.Enabled()
+	}
+	if !enabled {
+		return nil
+	}
+	if limits.Global.Enabled() {
+		l.global = newBucket("global", limits.Global)
+	}
+	for category, limit := range map[Category]config.Limit{Read: limits.Read, Mutate: limits.Mutate, Stream: limits.Stream} {
+		if limit.Enabled() {
+			l.categories[category] = newBucket(string(category), limit)
+		}
+	}
+	return l
+}
+
+// Limits returns the limits the limiter was created with.
+func (l *Limiter) Limits() config.Limits {
+	if l == nil {
+		return config.Limits{}
+	}
+	return l.limits
+}
+
+// clientBucket returns the bucket for client, creating it if needed.
+// Callers hold l.mu.
+func (l *Limiter) clientBucket(client string, now time.Time) *bucket {
+	if !l.limits.Client.Enabled() || client == "" {
+		return nil
+	}
+	if b, ok := l.clients[client]; ok {
+		b.used = now
+		return b
+	}
+	if len(l.clients) >= maxClients {
+		l.evictClients(now)
+	}
+	b := newBucket("client", l.limits.Client)
+	b.used = now
+	l.clients[client] = b
+	return b
+}
+
+// evictClients makes room for a new client bucket: it drops the idle
+// buckets, or the least recently used one when none is idle. Callers hold
+// l.mu.
+func (l *Limiter) evictClients(now time.Time) {
+	var oldest string
+	for name, b := range l.clients {
+		if b.idle(now) {
+			delete(l.clients, name)
+			continue
+		}
+		if oldest == "" || b.used.Before(l.clients[oldest].used) {
+			oldest = name
+		}
+	}
+	if len(l.clients) >= maxClients {
+		delete(l.clients, oldest)
+	}
+}
+
+// Acquire admits a call from client in category, or returns an *Error when a
+// limit is reached. release must be called when an admitted call finishes.
+func (l *Limiter) Acquire(client string, category Category) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var buckets []*bucket
+	for _, b := range []*bucket{l.global, l.clientBucket(client, now), l.categories[category]} {
+		if b != nil {
+			buckets = append(buckets, b)
+		}
+	}
+	for _, b := range buckets {
+		if b.limit.MaxInFlight > 0 && b.inFlight >= b.limit.MaxInFlight {
+			b.limited++
+			return nil, &Error{Scope: b.scope, RetryAfter: time.Second}
+		}
+	}
+	// Take a token from every bucket, or from none: a call refused by one
+	// limit must not use up the others.
+	var reserved []*rate.Reservation
+	for _, b := range buckets {
+		if b.tokens == nil {
+			continue
+		}
+		r := b.tokens.ReserveN(now, 1)
+		if delay := r.DelayFrom(now); !r.OK() || delay > 0 {
+			r.CancelAt(now)
+			for _, prev := range reserved {
+				prev.CancelAt(now)
+			}
+			b.limited++
+			return nil, &Error{Scope: b.scope, RetryAfter: delay}
+		}
+		reserved = append(reserved, r)
+	}
+	for _, b := range buckets {
+		b.inFlight++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for _, b := range buckets {
+				b.inFlight--
+			}
+		})
+	}, nil
+}
+
+// ScopeState is the current state of one limit.
+type ScopeState struct {
+	Rate        float64  `json:"rate_per_second,omitempty"`
+	Burst       int      `json:"burst,omitempty"`
+	Tokens      *float64 `json:"tokens,omitempty"` // Calls that can be made right now
+	InFlight    int      `json:"in_flight"`
+	MaxInFlight int      `json:"max_in_flight,omitempty"`
+	Limited     uint64   `json:"limited"` // Calls refused since the limiter was created
+}
+
+// State is a snapshot of every limit, for monitoring.
+type State struct {
+	Global     *ScopeState             `json:"global,omitempty"`
+	Categories map[Category]ScopeState `json:"categories,omitempty"`
+	Clients    map[string]ScopeState   `json:"clients,omitempty"`
+}
+
+func (b *bucket) state(now time.Time) ScopeState {
+	s := ScopeState{Rate: b.limit.Rate, Burst: b.limit.Burst, InFlight: b.inFlight, MaxInFlight: b.limit.MaxInFlight, Limited: b.limited}
+	if b.tokens != nil {
+		tokens := math.Max(0, b.tokens.TokensAt(now))
+		s.Tokens = &tokens
+	}
+	return s
+}
+
+// State returns the current state of the limits.
+func (l *Limiter) State() State {
+	if l == nil {
+		return State{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	state := State{Categories: make(map[Category]ScopeState), Clients: make(map[string]ScopeState)}
+	if l.global != nil {
+		s := l.global.state(now)
+		state.Global = &s
+	}
+	for category, b := range l.categories {
+		state.Categories[category] = b.state(now)
+	}
+	for client, b := range l.clients {
+		state.Clients[client] = b.state(now)
+	}
+	return state
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/config"
+)
+
+// Busy clients must not grow the client buckets past maxClients; the least
+// recently used one makes room for a new client.
+func TestClientBucketsAreBounded(t *testing.T) {
+	l := New(config.Limits{Client: config.Limit{MaxInFlight: 1}})
+	for i := range maxClients {
+		if _, err := l.Acquire(fmt.Sprintf("client-%d", i), Read); err != nil {
+			t.Fatalf("client-%d: %v", i, err)
+		}
+		time.Sleep(time.Microsecond)
+	}
+	// client-0 is the least recently used until it calls again.
+	if _, err := l.Acquire("client-0", Read); err == nil {
+		t.Fatal("client-0 got a second call in flight")
+	}
+	if _, err := l.Acquire("newcomer", Read); err != nil {
+		t.Fatalf("newcomer: %v", err)
+	}
+	state := l.State()
+	if n := len(state.Clients); n != maxClients {
+		t.Errorf("%d client buckets, want %d", n, maxClients)
+	}
+	if _, ok := state.Clients["client-1"]; ok {
+		t.Error("the least recently used client was kept")
+	}
+	if _, ok := state.Clients["client-0"]; !ok {
+		t.Error("a recently refused client was dropped")
+	}
+}
+
+func TestClientLimitIsPerClient(t *testing.T) {
+	l := New(config.Limits{Client: config.Limit{MaxInFlight: 1}})
+	release, err := l.Acquire("address 10.0.0.1", Read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var limited *Error
+	if _, err := l.Acquire("address 10.0.0.1", Read); !errors.As(err, &limited) || limited.Scope != "client" {
+		t.Errorf("second call from the same client: %v, want the client limit", err)
+	}
+	if _, err := l.Acquire("address 10.0.0.2", Read); err != nil {
+		t.Errorf("call from another client: %v", err)
+	}
+	release()
+	if _, err := l.Acquire("address 10.0.0.1", Read); err != nil {
+		t.Errorf("call after release: %v", err)
+	}
+}
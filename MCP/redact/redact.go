@@ -0,0 +1,72 @@
+// Package redact masks secrets in values that leave the server through logs,
+// traces and other telemetry, and in the tool results sent to clients.
+package redact
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces every redacted value.
+const Mask = "[REDACTED]"
+
+// sensitiveKeyRE matches names of fields, headers and environment variables
+// that hold secrets. "auth" must not match "author", a commit argument, and
+// Data is the payload of secrets.
+var sensitiveKeyRE = regexp.MustCompile(`(?i)(passw(or)?d|passphrase|secret|token|api[_-]?key|private[_-]?key|unlock[_-]?key|credential|authorization|auth([^o]|$)|^data$)`)
+
+// SensitiveKey reports whether a field or variable named key holds a secret.
+func SensitiveKey(key string) bool {
+	return sensitiveKeyRE.MatchString(key)
+}
+
+// Value returns a copy of v, as decoded from JSON, with the values of
+// sensitive keys masked. Strings of the form NAME=value, as in container
+// environments, are masked when NAME is sensitive.
+func Value(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			if SensitiveKey(k) && val != nil {
+				out[k] = Mask
+				continue
+			}
+			out[k] = Value(val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = Value(val)
+		}
+		return out
+	case string:
+		return envString(v)
+	default:
+		return v
+	}
+}
+
+// envString masks the value of a NAME=value string with a sensitive NAME.
+func envString(s string) string {
+	name, _, ok := strings.Cut(s, "=")
+	if !ok || name == "" || strings.ContainsAny(name, " \t\n") || !SensitiveKey(name) {
+		return s
+	}
+	return name + "=" + Mask
+}
+
+// JSON encodes Value(v), cutting the result to at most limit bytes when
+// limit is positive.
+func JSON(v any, limit int) string {
+	data, err := json.Marshal(Value(v))
+	if err != nil {
+		return ""
+	}
+	if limit > 0 && len(data) > limit {
+		return string(data[:limit]) + "..."
+	}
+	return string(data)
+}
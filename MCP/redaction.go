@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/docker-engine-api/mcp-server/clientauth"
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/docker-engine-api/mcp-server/redact"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// redactOutputHeader turns output redaction off for the session a request
+// opens, with the value "off". Only REDACT_OPTOUT_CLIENTS may send it.
+const redactOutputHeader = "REDACT_OUTPUT"
+
+// errRedactionRequired refuses an opt-out from a client that is not allowed one.
+var errRedactionRequired = errors.New("this client may not turn off output redaction")
+
+// loadOutputRedaction reads REDACT_OUTPUT and REDACT_ENV_PATTERNS; it returns
+// nil when redaction is turned off.
+func loadOutputRedaction() (*redact.Output, error) {
+	if off(config.Setting("REDACT_OUTPUT")) {
+		return nil, nil
+	}
+	out, err := redact.NewOutput(config.SettingList("REDACT_ENV_PATTERNS"))
+	if err != nil {
+		return nil, fmt.Errorf("REDACT_ENV_PATTERNS: %w", err)
+	}
+	return out, nil
+}
+
+func off(val string) bool {
+	on, ok := config.ParseBool(val)
+	return ok && !on
+}
+
+// sessionRedaction marks the context of a request that opens a session when
+// its REDACT_OUTPUT header turns redaction off. Only the authenticated
+// clients listed in REDACT_OPTOUT_CLIENTS may do so.
+func sessionRedaction(r *http.Request) (*http.Request, error) {
+	if !off(r.Header.Get(redactOutputHeader)) {
+		return r, nil
+	}
+	ctx := r.Context()
+	id, ok := clientauth.FromContext(ctx)
+	if !ok || !slices.Contains(config.SettingList("REDACT_OPTOUT_CLIENTS"), id.Name) {
+		log.Printf("Refused to turn off output redaction%s", clientSuffix(ctx))
+		return nil, errRedactionRequired
+	}
+	log.Printf("Output redaction turned off for a new session%s", clientSuffix(ctx))
+	return r.WithContext(redact.WithoutOutput(ctx)), nil
+}
+
+// withRedaction masks secrets in the text and structured content of tool
+// results: environment variables and labels named like secrets, registry
+// credentials and known credential formats. Sessions that opted out get the
+// results unchanged.
+func withRedaction(out *redact.Output) toolMiddleware {
+	return func(tool models.Tool) models.Tool {
+		if out == nil {
+			return tool
+		}
+		next := tool.Handler
+		tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := next(ctx, request)
+			if result == nil || redact.OutputDisabled(ctx) {
+				return result, err
+			}
+			for i, content := range result.Content {
+				switch content := content.(type) {
+				case mcp.TextContent:
+					content.Text = out.Text(content.Text)
+					result.Content[i] = content
+				case *mcp.TextContent:
+					content.Text = out.Text(content.Text)
+				}
+			}
+			if result.StructuredContent != nil {
+				// Round trip through JSON so typed values are masked like the
+				// daemon's answers.
+				var v any
+				if data, err := json.Marshal(result.StructuredContent); err == nil && json.Unmarshal(data, &v) == nil {
+					result.StructuredContent = out.Value(v)
+				}
+			}
+			return result, err
+		}
+		return tool
+	}
+}
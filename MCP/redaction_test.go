@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/clientauth"
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/docker-engine-api/mcp-server/redact"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// inspectTool answers like an inspect of a container with a secret in its
+// environment, in text and structured content.
+var inspectTool = models.Tool{
+	Definition: mcp.NewTool("get_containers_id_json"),
+	Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result := mcp.NewToolResultStructured(struct {
+			Env []string
+		}{[]string{"DB_PASSWORD=hunter2"}}, `{"Env": ["DB_PASSWORD=hunter2"]}`)
+		result.Content = append(result.Content, &mcp.TextContent{Type: "text", Text: "export API_TOKEN=abc"})
+		return result, nil
+	},
+}
+
+func TestWithRedaction(t *testing.T) {
+	out, _ := redact.NewOutput(nil)
+	tool := withRedaction(out)(inspectTool)
+
+	result, err := tool.Handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; strings.Contains(text, "hunter2") || !strings.Contains(text, "DB_PASSWORD="+redact.Mask) {
+		t.Errorf("text content %s", text)
+	}
+	if text := result.Content[1].(*mcp.TextContent).Text; text != "export API_TOKEN="+redact.Mask {
+		t.Errorf("text content pointer %s", text)
+	}
+	want := map[string]any{"Env": []any{"DB_PASSWORD=" + redact.Mask}}
+	if !reflect.DeepEqual(result.StructuredContent, want) {
+		t.Errorf("structured content %v, want %v", result.StructuredContent, want)
+	}
+
+	// Sessions that opted out, and servers with redaction off, get results unchanged.
+	for name, tool := range map[string]models.Tool{"opted out": tool, "off": withRedaction(nil)(inspectTool)} {
+		ctx := context.Background()
+		if name == "opted out" {
+			ctx = redact.WithoutOutput(ctx)
+		}
+		result, _ := tool.Handler(ctx, mcp.CallToolRequest{})
+		if text := resultText(result); !strings.Contains(text, "hunter2") {
+			t.Errorf("%s: %s, want the result unchanged", name, text)
+		}
+	}
+}
+
+func TestSessionRedaction(t *testing.T) {
+	t.Setenv("REDACT_OPTOUT_CLIENTS", "debugger, support")
+	tests := []struct {
+		name    string
+		header  string
+		client  string // Authenticated identity, empty for none
+		wantOff bool
+		wantErr bool
+	}{
+		{"no header", "", "debugger", false, false},
+		{"redaction kept on", "on", "ops", false, false},
+		{"privileged client", "off", "debugger", true, false},
+		{"privileged client, other spelling", "0", "support", true, false},
+		{"other client", "off", "ops", false, true},
+		{"unauthenticated", "off", "", false, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/mcp", nil)
+		if tt.header != "" {
+			r.Header.Set(redactOutputHeader, tt.header)
+		}
+		if tt.client != "" {
+			r = r.WithContext(clientauth.NewContext(r.Context(), clientauth.Identity{Name: tt.client, Method: "token"}))
+		}
+		got, err := sessionRedaction(r)
+		if tt.wantErr {
+			if !errors.Is(err, errRedactionRequired) {
+				t.Errorf("%s: %v, want the opt-out refused", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if off := redact.OutputDisabled(got.Context()); off != tt.wantOff {
+			t.Errorf("%s: redaction off %t, want %t", tt.name, off, tt.wantOff)
+		}
+	}
+}
+
+// redactionTestServer serves /mcp with inspectTool behind the redaction
+// middleware. The X-Test-Client header stands in for an authenticated client.
+func redactionTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	out, _ := redact.NewOutput(nil)
+	tool := withRedaction(out)(inspectTool)
+	mcpSrv := server.NewMCPServer("test", "1")
+	mcpSrv.AddTool(tool.Definition, tool.Handler)
+	sessions := newSessionStore(time.Hour)
+	streamable := server.NewStreamableHTTPServer(mcpSrv,
+		server.WithSessionIdManager(sessions),
+		server.WithHTTPContextFunc(sessions.contextFunc),
+	)
+	sessionConfig := func(r *http.Request) (*config.APIConfig, int, error) {
+		return &config.APIConfig{Host: "tcp://daemon:2375"}, 0, nil
+	}
+	handler := streamableHandler(streamable, sessionConfig)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := r.Header.Get("X-Test-Client"); name != "" {
+			r = r.WithContext(clientauth.NewContext(r.Context(), clientauth.Identity{Name: name, Method: "token"}))
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// The opt-out is decided when the session opens and holds for its calls;
+// clients that may not opt out are refused the session.
+func TestRedactionOptOutSessions(t *testing.T) {
+	t.Setenv("REDACT_OPTOUT_CLIENTS", "debugger")
+	srv := redactionTestServer(t)
+	call := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"get_containers_id_json","arguments":{}}}`
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+		wantSecret bool
+	}{
+		{"privileged opt-out", map[string]string{"X-Test-Client": "debugger", redactOutputHeader: "off"}, http.StatusOK, true},
+		{"privileged, no opt-out", map[string]string{"X-Test-Client": "debugger"}, http.StatusOK, false},
+		{"other client", map[string]string{"X-Test-Client": "ops", redactOutputHeader: "off"}, http.StatusForbidden, false},
+		{"unauthenticated", map[string]string{redactOutputHeader: "off"}, http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		resp, body := mcpPost(t, srv.URL, tt.headers, initializeRequest)
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: initialize status %d, want %d: %s", tt.name, resp.StatusCode, tt.wantStatus, body)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			if !strings.Contains(body, errRedactionRequired.Error()) || resp.Header.Get(server.HeaderKeySessionID) != "" {
+				t.Errorf("%s: refused with %q, session %q", tt.name, body, resp.Header.Get(server.HeaderKeySessionID))
+			}
+			continue
+		}
+		// Later requests of the session do not repeat the header.
+		headers := map[string]string{server.HeaderKeySessionID: resp.Header.Get(server.HeaderKeySessionID)}
+		_, body = mcpPost(t, srv.URL, headers, call)
+		if got := strings.Contains(body, "hunter2"); got != tt.wantSecret {
+			t.Errorf("%s: secret in the result %t, want %t: %s", tt.name, got, tt.wantSecret, body)
+		}
+	}
+}
@@ -20,8 +20,9 @@ import (
 	tools_tasks "github.com/docker-engine-api/mcp-server/tools/tasks"
 )
 
+// GetAll returns every tool, or only the read-only ones when READ_ONLY is set.
 func GetAll(cfg *config.APIConfig) []models.Tool {
-	return []models.Tool{
+	tools := []models.Tool{
 		tools_container.CreateContainerwaitTool(cfg),
 		tools_secret.CreateSecretcreateTool(cfg),
 		tools_image.CreateImagepruneTool(cfg),
@@ -116,4 +117,14 @@ func GetAll(cfg *config.APIConfig) []models.Tool {
 		tools_config.CreateConfigdeleteTool(cfg),
 		tools_config.CreateConfiginspectTool(cfg),
 	}
+	if !config.ReadOnly() {
+		return tools
+	}
+	readOnly := make([]models.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if tool.ReadOnly {
+			readOnly = append(readOnly, tool)
+		}
+	}
+	return readOnly
 }
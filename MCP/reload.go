@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/docker-engine-api/mcp-server/policy"
+	"github.com/docker-engine-api/mcp-server/ratelimit"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// configPollInterval is how often the configuration file is checked for changes.
+const configPollInterval = 2 * time.Second
+
+// toolSet owns the tools registered on the server and the settings they are
+// built from. Reloading rebuilds them and replaces the registered tools in
+// place, so sessions stay connected and are told the tool list changed.
+type toolSet struct {
+	srv  *server.MCPServer
+	mode string
+
+	mu        sync.Mutex
+	file      *config.File
+	cfg       *config.APIConfig
+	endpoints config.Endpoints
+	allow     *config.DaemonAllowlist
+	limiter   *ratelimit.Limiter
+	policy    *policy.Policy
+}
+
+func newToolSet(srv *server.MCPServer, mode string, file *config.File, cfg *config.APIConfig, endpoints config.Endpoints, allow *config.DaemonAllowlist, limiter *ratelimit.Limiter, pol *policy.Policy) *toolSet {
+	return &toolSet{srv: srv, mode: mode, file: file, cfg: cfg, endpoints: endpoints, allow: allow, limiter: limiter, policy: pol}
+}
+
+// apply registers the tools for the current settings.
+func (t *toolSet) apply() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tools := buildTools(t.cfg, t.endpoints, t.allow, t.limiter, t.policy, t.mode)
+	serverTools := make([]server.ServerTool, 0, len(tools))
+	for _, tool := range tools {
+		serverTools = append(serverTools, server.ServerTool{Tool: tool.Definition, Handler: tool.Handler})
+	}
+	t.srv.SetTools(serverTools...)
+}
+
+// defaultEndpoint returns the first named endpoint, nil when there are none.
+func (t *toolSet) defaultEndpoint() *config.APIConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.endpoints) == 0 {
+		return nil
+	}
+	return t.endpoints[0].Config
+}
+
+// daemonAllowlist returns the endpoints and daemon allowlist that requests
+// choosing a daemon by header are checked against.
+func (t *toolSet) daemonAllowlist() (config.Endpoints, *config.DaemonAllowlist) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.endpoints, t.allow
+}
+
+// daemons returns the daemons configured on the server: the named
+// endpoints, or the single daemon from the environment named "default".
+func (t *toolSet) daemons() config.Endpoints {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.endpoints) > 0 {
+		return t.endpoints
+	}
+	if t.cfg.Host == "" {
+		return config.Endpoints{}
+	}
+	return config.Endpoints{{Name: "default", Address: t.cfg.Host, Config: t.cfg}}
+}
+
+// rateLimits returns the current state of the tool call limits.
+func (t *toolSet) rateLimits() ratelimit.State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limiter.State()
+}
+
+// reload re-reads the configuration file and applies the settings that can
+// change at runtime: the tool allow and deny lists, tool timeouts, named
+// endpoints, the daemons clients may choose by header, rate limits and the
+// policy rules, which are read again. The new file is checked in full before
+// it is made active; an invalid file is rejected and the running settings
+// are kept. Endpoints that were removed or changed are closed.
+func (t *toolSet) reload(filename string) {
+	file, err := config.LoadFile(filename)
+	var settings config.Reloadable
+	if err == nil {
+		settings, err = config.LoadReloadable(file)
+	}
+	var pol *policy.Policy
+	if err == nil {
+		pol, err = loadPolicy(file.Setting("POLICY_FILE"))
+	}
+	if err != nil {
+		log.Printf("Reload failed, keeping the previous configuration: %v", err)
+		return
+	}
+
+	t.mu.Lock()
+	previous, previousEndpoints := t.file, t.endpoints
+	config.UseFile(file)
+	cfg := *t.cfg
+	cfg.Client.DefaultTimeout = settings.Client.DefaultTimeout
+	cfg.Client.LongTimeout = settings.Client.LongTimeout
+	t.cfg = &cfg
+	t.endpoints = config.ReuseUnchanged(previousEndpoints, settings.Endpoints)
+	t.allow = settings.Allow
+	t.policy = pol
+	if !reflect.DeepEqual(settings.Limits, t.limiter.Limits()) {
+		// Changed limits start from fresh buckets.
+		t.limiter = ratelimit.New(settings.Limits)
+	}
+	t.file = file
+	endpoints := t.endpoints
+	t.mu.Unlock()
+
+	if previous != nil {
+		for _, section := range restartOnlyChanges(previous, file) {
+			log.Printf("Reload: %s changed, restart the server to apply it", section)
+		}
+	}
+	t.apply()
+	config.CloseRemoved(previousEndpoints, endpoints)
+	log.Printf("Reloaded configuration from %s", filename)
+}
+
+// restartOnlyChanges lists the sections of the file that differ between a
+// and b but are only read at startup.
+func restartOnlyChanges(a, b *config.File) []string {
+	var changed []string
+	sections := []struct {
+		name string
+		a, b any
+	}{
+		{"listener", a.Listener, b.Listener},
+		{"client_auth", a.ClientAuth, b.ClientAuth},
+		{"daemon", a.Daemon, b.Daemon},
+		{"tls", a.TLS, b.TLS},
+		{"auth", a.Auth, b.Auth},
+		{"ssh", a.SSH, b.SSH},
+		{"http", a.HTTP, b.HTTP},
+		{"tracing", a.Tracing, b.Tracing},
+		{"audit", a.Audit, b.Audit},
+		{"logging", a.Logging, b.Logging},
+	}
+	for _, s := range sections {
+		if !reflect.DeepEqual(s.a, s.b) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+// watchConfig calls reload when the process receives SIGHUP or the file's
+// modification time changes, until ctx is done.
+func watchConfig(ctx context.Context, filename string, reload func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	modTime := func() time.Time {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	last := modTime()
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Println("SIGHUP received, reloading configuration")
+			last = modTime()
+			reload()
+		case <-ticker.C:
+			if current := modTime(); !current.IsZero() && !current.Equal(last) {
+				last = current
+				reload()
+			}
+		}
+	}
+}
+
+// filterTools keeps the tools of the given toolsets plus those matched by
+// allow, or every tool when both are empty, and then drops those matched by
+// deny. Patterns use path.Match syntax. Tools without a toolset are kept
+// whenever toolsets are selected. What is left out is logged with the reason.
+func filterTools(tools []models.Tool, toolsets, allow, deny []string) []models.Tool {
+	match := func(patterns []string, name string) string {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return pattern
+			}
+		}
+		return ""
+	}
+	var reasons []string
+	filtered := map[string][]string{}
+	drop := func(reason, name string) {
+		if filtered[reason] == nil {
+			reasons = append(reasons, reason)
+		}
+		filtered[reason] = append(filtered[reason], name)
+	}
+
+	kept := make([]models.Tool, 0, len(tools))
+	for _, tool := range tools {
+		name := tool.Definition.Name
+		if pattern := match(deny, name); pattern != "" {
+			drop(fmt.Sprintf("matched TOOLS_DENY %q", pattern), name)
+			continue
+		}
+		selected := len(toolsets) == 0 && len(allow) == 0
+		if len(toolsets) > 0 && (tool.Toolset == "" || slices.Contains(toolsets, tool.Toolset)) {
+			selected = true
+		}
+		if !selected && match(allow, name) == "" {
+			if len(toolsets) > 0 && tool.Toolset != "" {
+				drop(fmt.Sprintf("toolset %s not enabled", tool.Toolset), name)
+			} else {
+				drop("not matched by TOOLS_ALLOW", name)
+			}
+			continue
+		}
+		kept = append(kept, tool)
+	}
+	for _, reason := range reasons {
+		log.Printf("Filtered %d tools, %s: %s", len(filtered[reason]), reason, strings.Join(filtered[reason], ", "))
+	}
+	return kept
+}
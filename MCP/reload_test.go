@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/docker-engine-api/mcp-server/ratelimit"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// reloadSettings are the environment variables that would take precedence
+// over the files of the reload tests.
+var reloadSettings = []string{"DOCKER_ENDPOINTS", "ALLOWED_DAEMONS", "TOOLSETS", "TOOLS_ALLOW", "TOOLS_DENY", "TOOL_TIMEOUT", "TOOL_LONG_TIMEOUT", "RATE_LIMIT_GLOBAL", "MAX_IN_FLIGHT_GLOBAL", "POLICY_FILE", "DESTRUCTIVE_MODE", "READ_ONLY", "LOG_TOOL_CALLS"}
+
+const reloadBase = `
+endpoints:
+  - name: prod
+    host: tcp://127.0.0.1:2375
+  - name: staging
+    host: tcp://127.0.0.2:2375
+headers:
+  allowed_daemons: [prod, staging]
+timeouts:
+  tool: 10s
+tools:
+  deny: [post_swarm_leave]
+limits:
+  global:
+    rate: 50/s
+`
+
+func writeConfig(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startToolSet loads file the way main does and registers its tools.
+func startToolSet(t *testing.T, file string) (*toolSet, *server.MCPServer) {
+	t.Helper()
+	for _, key := range reloadSettings {
+		t.Setenv(key, "")
+	}
+	t.Setenv("DOCKER_API_VERSION", "1.41")
+	f, err := config.LoadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.UseFile(f)
+	t.Cleanup(func() { config.UseFile(nil) })
+	endpoints, err := config.LoadEndpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow, err := config.LoadDaemonAllowlist(endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := config.LoadLimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := config.LoadClientOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.APIConfig{BaseURL: "tcp://127.0.0.1:2375", Client: opts}
+	if err := cfg.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	srv := server.NewMCPServer("test", "1.0", server.WithToolCapabilities(true))
+	tools := newToolSet(srv, "STDIO", f, cfg, endpoints, allow, ratelimit.New(limits), nil)
+	tools.apply()
+	return tools, srv
+}
+
+// registeredTools returns the names of the tools srv lists.
+func registeredTools(t *testing.T, srv *server.MCPServer) map[string]bool {
+	t.Helper()
+	reply, err := json.Marshal(srv.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Result struct {
+			Tools []struct{ Name string }
+		}
+	}
+	if err := json.Unmarshal(reply, &list); err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, tool := range list.Result.Tools {
+		names[tool.Name] = true
+	}
+	return names
+}
+
+func TestReloadAppliesFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, file, reloadBase)
+	tools, srv := startToolSet(t, file)
+	before := tools.endpoints
+	limiter := tools.limiter
+	if names := registeredTools(t, srv); names["post_swarm_leave"] || !names["delete_containers_id"] {
+		t.Fatalf("tools before the reload: post_swarm_leave %t, delete_containers_id %t", names["post_swarm_leave"], names["delete_containers_id"])
+	}
+
+	writeConfig(t, file, `
+endpoints:
+  - name: prod
+    host: tcp://127.0.0.1:2375
+  - name: staging
+    host: tcp://127.0.0.3:2375
+  - name: dev
+    host: tcp://127.0.0.4:2375
+headers:
+  allowed_daemons: [prod, dev]
+timeouts:
+  tool: 10s
+tools:
+  deny: [post_swarm_leave, delete_*]
+limits:
+  global:
+    rate: 10/s
+`)
+	tools.reload(file)
+
+	if got := tools.endpoints.Names(); !reflect.DeepEqual(got, []string{"prod", "staging", "dev"}) {
+		t.Errorf("endpoints %v after the reload", got)
+	}
+	if prod, _ := tools.endpoints.Lookup("prod"); prod.Config != before[0].Config {
+		t.Error("the unchanged endpoint was replaced, losing its connections")
+	}
+	if staging, _ := tools.endpoints.Lookup("staging"); staging.Config == before[1].Config || staging.Address != "tcp://127.0.0.3:2375" {
+		t.Errorf("the changed endpoint was kept: %s", staging.Address)
+	}
+	if tools.allow.AllowsEndpoint("staging") || !tools.allow.AllowsEndpoint("dev") {
+		t.Error("the allowlist was not reloaded")
+	}
+	if tools.limiter == limiter || tools.limiter.Limits().Global.Rate == limiter.Limits().Global.Rate {
+		t.Error("the changed rate limit was not applied")
+	}
+	if names := registeredTools(t, srv); names["delete_containers_id"] || !names["get_containers_json"] {
+		t.Errorf("tools after the reload: delete_containers_id %t, get_containers_json %t", names["delete_containers_id"], names["get_containers_json"])
+	}
+
+	// New client options replace every endpoint built from them.
+	prod, _ := tools.endpoints.Lookup("prod")
+	writeConfig(t, file, strings.Replace(reloadBase, "tool: 10s", "tool: 20s", 1))
+	tools.reload(file)
+	if got := tools.cfg.Client.DefaultTimeout; got != 20*time.Second {
+		t.Errorf("tool timeout %s, want 20s", got)
+	}
+	if now, _ := tools.endpoints.Lookup("prod"); now.Config == prod.Config || now.Config.Client.DefaultTimeout != 20*time.Second {
+		t.Error("the endpoint kept the previous client options")
+	}
+}
+
+// A file that fails any setting is rejected as a whole: neither its own
+// settings nor those that were valid are applied.
+func TestReloadRejectsInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	writeConfig(t, file, reloadBase)
+	tools, srv := startToolSet(t, file)
+	t.Setenv("DOCKER_CONFIG", dir)
+	want := registeredTools(t, srv)
+	previous, endpoints, limiter := tools.file, tools.endpoints, tools.limiter
+
+	valid := "tools:\n  deny: [delete_*]\ntimeouts:\n  tool: 20s\n"
+	for name, content := range map[string]string{
+		"syntax":    "tools: [",
+		"endpoint":  valid + "endpoints:\n  - name: prod\n    host: no-such-context\n",
+		"allowlist": valid + "headers:\n  allowed_daemons: [nowhere]\n",
+		"limits":    valid + "limits:\n  global:\n    rate: often\n",
+		"policy":    valid + "policy:\n  file: " + filepath.Join(dir, "missing.yaml") + "\n",
+		"toolsets":  "tools:\n  deny: [delete_*]\n  toolsets: [containers, volume]\n",
+	} {
+		writeConfig(t, file, content)
+		tools.reload(file)
+		if tools.file != previous || !reflect.DeepEqual(tools.endpoints, endpoints) || tools.limiter != limiter {
+			t.Errorf("%s: the rejected file replaced the running settings", name)
+		}
+		if got := config.Setting("TOOLS_DENY"); got != "post_swarm_leave" {
+			t.Errorf("%s: TOOLS_DENY is %q after a rejected reload", name, got)
+		}
+		if got := tools.cfg.Client.DefaultTimeout; got != 10*time.Second {
+			t.Errorf("%s: tool timeout %s after a rejected reload", name, got)
+		}
+		if got := registeredTools(t, srv); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: the registered tools changed", name)
+		}
+	}
+}
+
+func TestRestartOnlyChanges(t *testing.T) {
+	base := func() *config.File {
+		return &config.File{
+			Listener: config.FileListener{Port: "8080"},
+			Daemon:   config.FileDaemon{Host: "unix:///var/run/docker.sock"},
+			Tools:    config.FileTools{Deny: []string{"post_swarm_leave"}},
+		}
+	}
+	tests := []struct {
+		change func(f *config.File)
+		want   []string
+	}{
+		{func(f *config.File) {}, nil},
+		// Runtime settings are applied, not reported.
+		{func(f *config.File) { f.Tools.Deny = nil; f.Timeouts.Tool = "5s" }, nil},
+		{func(f *config.File) { f.Listener.Port = "9090" }, []string{"listener"}},
+		{func(f *config.File) { f.Daemon.APIVersion = "1.41"; f.SSH.KeyFile = "id_ed25519" }, []string{"daemon", "ssh"}},
+		{func(f *config.File) { f.Audit.File = "audit.log"; f.Logging.ToolCalls = true }, []string{"audit", "logging"}},
+	}
+	for _, tt := range tests {
+		changed := base()
+		tt.change(changed)
+		if got := restartOnlyChanges(base(), changed); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("restartOnlyChanges = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestFilterTools(t *testing.T) {
+	tool := func(name, toolset string) models.Tool {
+		return models.Tool{Definition: mcp.NewTool(name), Toolset: toolset}
+	}
+	tools := []models.Tool{
+		tool("get_containers_json", models.ToolsetContainers),
+		tool("delete_containers_id", models.ToolsetContainers),
+		tool("get_images_json", models.ToolsetImages),
+		tool("get_volumes", models.ToolsetVolumes),
+		tool("get_volumes_name", models.ToolsetVolumes),
+		tool("post_volumes_prune", models.ToolsetVolumes),
+		tool("list_hosts", ""),
+	}
+	tests := []struct {
+		name                  string
+		toolsets, allow, deny []string
+		want                  []string
+	}{
+		{name: "everything", want: []string{"get_containers_json", "delete_containers_id", "get_images_json", "get_volumes", "get_volumes_name", "post_volumes_prune", "list_hosts"}},
+		{name: "toolsets", toolsets: []string{"containers", "images"}, want: []string{"get_containers_json", "delete_containers_id", "get_images_json", "list_hosts"}},
+		{name: "toolsets and allow", toolsets: []string{"images"}, allow: []string{"get_volumes*"}, want: []string{"get_images_json", "get_volumes", "get_volumes_name", "list_hosts"}},
+		{name: "allow alone", allow: []string{"get_volumes*", "list_hosts"}, want: []string{"get_volumes", "get_volumes_name", "list_hosts"}},
+		{name: "deny", deny: []string{"*_prune", "delete_*"}, want: []string{"get_containers_json", "get_images_json", "get_volumes", "get_volumes_name", "list_hosts"}},
+		{name: "deny wins", toolsets: []string{"volumes"}, allow: []string{"post_volumes_prune"}, deny: []string{"*_prune", "list_hosts"}, want: []string{"get_volumes", "get_volumes_name"}},
+		{name: "bad pattern matches nothing", allow: []string{"get_[volumes"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, tool := range filterTools(tools, tt.toolsets, tt.allow, tt.deny) {
+				got = append(got, tool.Definition.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
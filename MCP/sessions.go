@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/clientauth"
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/docker-engine-api/mcp-server/redact"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const sessionIDPrefix = "mcp-session-"
+
+// defaultSessionIdleTimeout is how long an HTTP session survives without requests.
+const defaultSessionIdleTimeout = 30 * time.Minute
+
+// sessionStore keeps the daemon configuration each HTTP session was started
+// with. It is also the streamable server's session id manager, so sessions
+// that expire or are deleted are rejected like unknown ones.
+type sessionStore struct {
+	idle time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*sessionEntry
+}
+
+type sessionEntry struct {
+	cfg      *config.APIConfig
+	lastSeen time.Time
+	// stream sessions (SSE) end with their event stream instead of expiring.
+	stream bool
+	// unredacted sessions opted out of output redaction when they opened.
+	unredacted bool
+}
+
+func newSessionStore(idle time.Duration) *sessionStore {
+	return &sessionStore{idle: idle, sessions: make(map[string]*sessionEntry)}
+}
+
+// Generate creates the id for a new session; its config is bound on the
+// initialize request that asked for it.
+func (s *sessionStore) Generate() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	id := sessionIDPrefix + hex.EncodeToString(buf)
+	s.mu.Lock()
+	s.sessions[id] = &sessionEntry{lastSeen: time.Now()}
+	s.mu.Unlock()
+	return id
+}
+
+// Validate accepts live sessions and refreshes their idle timer. Unknown,
+// expired and unbound ids are reported as terminated so clients initialize
+// again; a session without a daemon config must never reach a tool, which
+// would fall back to the server's own daemon.
+func (s *sessionStore) Validate(sessionID string) (isTerminated bool, err error) {
+	if !strings.HasPrefix(sessionID, sessionIDPrefix) {
+		return false, fmt.Errorf("invalid session id: %s", sessionID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.sessions[sessionID]
+	if !ok || entry.cfg == nil || s.expired(entry) {
+		delete(s.sessions, sessionID)
+		return true, nil
+	}
+	entry.lastSeen = time.Now()
+	return false, nil
+}
+
+func (s *sessionStore) Terminate(sessionID string) (isNotAllowed bool, err error) {
+	s.mu.Lock()
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+	return false, nil
+}
+
+func (s *sessionStore) expired(entry *sessionEntry) bool {
+	return !entry.stream && s.idle > 0 && time.Since(entry.lastSeen) > s.idle
+}
+
+// count returns the number of sessions that have not expired.
+func (s *sessionStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, entry := range s.sessions {
+		if !s.expired(entry) {
+			n++
+		}
+	}
+	return n
+}
+
+// attach tracks SSE sessions, which mcp-go registers when their event stream
+// opens and unregisters when it closes. The stream request carries the
+// session's config; streamable HTTP sessions are bound in contextFunc instead.
+func (s *sessionStore) attach(hooks *server.Hooks) {
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		cfg := config.FromContext(ctx, nil)
+		if cfg == nil {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.sessions[session.SessionID()]; ok {
+			return
+		}
+		s.sessions[session.SessionID()] = &sessionEntry{cfg: cfg, lastSeen: time.Now(), stream: true, unredacted: redact.OutputDisabled(ctx)}
+		log.Printf("New session %s for %s%s", session.SessionID(), config.RedactHost(cfg.Host), clientSuffix(ctx))
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if entry, ok := s.sessions[session.SessionID()]; ok && entry.stream {
+			delete(s.sessions, session.SessionID())
+		}
+	})
+}
+
+// bind returns the config of a session and whether it opted out of output
+// redaction, storing cfg and unredacted if the session has no config yet.
+// A nil cfg is never stored; the session then stays unbound and Validate
+// refuses it.
+func (s *sessionStore) bind(ctx context.Context, sessionID string, cfg *config.APIConfig, unredacted bool) (*config.APIConfig, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.sessions[sessionID]
+	if !ok {
+		return cfg, unredacted
+	}
+	if entry.cfg == nil && cfg != nil {
+		entry.cfg = cfg
+		entry.unredacted = unredacted
+		log.Printf("New session %s for %s%s", sessionID, config.RedactHost(cfg.Host), clientSuffix(ctx))
+	}
+	return entry.cfg, entry.unredacted
+}
+
+// expire drops idle sessions every interval until ctx is done.
+func (s *sessionStore) expire(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			for id, entry := range s.sessions {
+				if s.expired(entry) {
+					delete(s.sessions, id)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// contextFunc attaches the session's config, and its output redaction
+// opt-out, to each request. Both come from the request that opened the
+// session, see sessionConfig and sessionRedaction. The client's address is
+// attached as well, for per-client rate limits.
+func (s *sessionStore) contextFunc(ctx context.Context, r *http.Request) context.Context {
+	ctx = withRemoteAddr(ctx, r)
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return ctx
+	}
+	cfg, unredacted := s.bind(ctx, session.SessionID(), config.FromContext(r.Context(), nil), redact.OutputDisabled(r.Context()))
+	if unredacted {
+		ctx = redact.WithoutOutput(ctx)
+	}
+	if cfg != nil {
+		return config.NewContext(ctx, cfg)
+	}
+	return ctx
+}
+
+// sessionConfigFunc reads the daemon config a new session keeps from the
+// request that opens it, or the HTTP status and error to refuse it with.
+type sessionConfigFunc func(r *http.Request) (*config.APIConfig, int, error)
+
+// streamableHandler opens sessions for the streamable HTTP server next. Every
+// initialize request starts a new session, with or without a session id
+// header, so each one is given the daemon config from its headers and its
+// redaction opt-out is checked; requests that fail are refused before they
+// reach next.
+func streamableHandler(next http.Handler, sessionConfig sessionConfigFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && isInitialize(r) {
+			apiCfg, status, err := sessionConfig(r)
+			if err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+			if r, err = sessionRedaction(r); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			r = r.WithContext(config.NewContext(r.Context(), apiCfg))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isInitialize reports whether the JSON-RPC message in the body of r is an
+// initialize request. The body is put back for the MCP server to read.
+func isInitialize(r *http.Request) bool {
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	var msg struct {
+		Method mcp.MCPMethod `json:"method"`
+	}
+	return json.Unmarshal(body, &msg) == nil && msg.Method == mcp.MethodInitialize
+}
+
+// clientSuffix names the authenticated client of ctx for log lines.
+func clientSuffix(ctx context.Context) string {
+	if id, ok := clientauth.FromContext(ctx); ok {
+		return fmt.Sprintf(" (client %s via %s)", id.Name, id.Method)
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestSessionStore(t *testing.T) {
+	s := newSessionStore(time.Hour)
+	prod := &config.APIConfig{Host: "tcp://prod:2376"}
+
+	id := s.Generate()
+	if !strings.HasPrefix(id, sessionIDPrefix) {
+		t.Fatalf("session id %q", id)
+	}
+	if cfg, _ := s.bind(context.Background(), id, prod, true); cfg != prod {
+		t.Fatalf("bind returned %v, want the new config", cfg)
+	}
+	if cfg, unredacted := s.bind(context.Background(), id, &config.APIConfig{Host: "tcp://other:2375"}, false); cfg != prod || !unredacted {
+		t.Errorf("second bind = %v, %t; want the first config and opt-out kept", cfg, unredacted)
+	}
+	if terminated, err := s.Validate(id); terminated || err != nil {
+		t.Errorf("Validate(bound session) = %t, %v", terminated, err)
+	}
+	if n := s.count(); n != 1 {
+		t.Errorf("count %d, want 1", n)
+	}
+
+	s.Terminate(id)
+	if terminated, _ := s.Validate(id); !terminated {
+		t.Error("a terminated session is still valid")
+	}
+	if _, err := s.Validate("made-up"); err == nil {
+		t.Error("an id without the prefix was accepted")
+	}
+	if terminated, _ := s.Validate(sessionIDPrefix + "00"); !terminated {
+		t.Error("an unknown session is valid")
+	}
+
+	// A session that never got a daemon config must not be used.
+	unbound := s.Generate()
+	if cfg, _ := s.bind(context.Background(), unbound, nil, false); cfg != nil {
+		t.Errorf("bind(nil) returned %v", cfg)
+	}
+	if terminated, _ := s.Validate(unbound); !terminated {
+		t.Error("an unbound session is valid")
+	}
+
+	idle := newSessionStore(time.Millisecond)
+	id = idle.Generate()
+	idle.bind(context.Background(), id, prod, false)
+	time.Sleep(5 * time.Millisecond)
+	if terminated, _ := idle.Validate(id); !terminated {
+		t.Error("an idle session did not expire")
+	}
+}
+
+func TestSessionContextFunc(t *testing.T) {
+	s := newSessionStore(time.Hour)
+	mcpSrv := server.NewMCPServer("test", "1")
+	prod := &config.APIConfig{Host: "tcp://prod:2376"}
+	id := s.Generate()
+	s.bind(context.Background(), id, prod, false)
+
+	r := httptest.NewRequest("POST", "/mcp", nil)
+	r.RemoteAddr = "192.0.2.7:50000"
+	session := server.NewInProcessSession(id, nil)
+	ctx := s.contextFunc(mcpSrv.WithContext(context.Background(), session), r)
+	if cfg := config.FromContext(ctx, nil); cfg != prod {
+		t.Errorf("config %v, want the session's", cfg)
+	}
+	if client := rateLimitClient(ctx); client != "address 192.0.2.7" {
+		t.Errorf("rate limit client %q", client)
+	}
+}
+
+// mcpTestServer serves /mcp like main does, with a tool reporting the
+// daemon its call would go to. Sessions need an X-Daemon header.
+func mcpTestServer(t *testing.T, serverCfg *config.APIConfig) *httptest.Server {
+	t.Helper()
+	mcpSrv := server.NewMCPServer("test", "1")
+	mcpSrv.AddTool(mcp.NewTool("whoami"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(config.FromContext(ctx, serverCfg).Host), nil
+	})
+	sessions := newSessionStore(time.Hour)
+	streamable := server.NewStreamableHTTPServer(mcpSrv,
+		server.WithSessionIdManager(sessions),
+		server.WithHTTPContextFunc(sessions.contextFunc),
+	)
+	sessionConfig := func(r *http.Request) (*config.APIConfig, int, error) {
+		host := r.Header.Get("X-Daemon")
+		if host == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("Missing API_BASE_URL header")
+		}
+		return &config.APIConfig{Host: host}, 0, nil
+	}
+	srv := httptest.NewServer(streamableHandler(streamable, sessionConfig))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func mcpPost(t *testing.T, url string, headers map[string]string, body string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url+"/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+const initializeRequest = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`
+
+func callWhoami(t *testing.T, url, sessionID string) string {
+	t.Helper()
+	resp, body := mcpPost(t, url, map[string]string{server.HeaderKeySessionID: sessionID},
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"whoami","arguments":{}}}`)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Sprintf("status %d: %s", resp.StatusCode, body)
+	}
+	var msg struct {
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(body), &msg); err != nil || len(msg.Result.Content) == 0 {
+		t.Fatalf("tools/call response %s: %v", body, err)
+	}
+	return msg.Result.Content[0].Text
+}
+
+func TestInitializeOpensSessionWithItsDaemon(t *testing.T) {
+	srv := mcpTestServer(t, &config.APIConfig{Host: "unix:///var/run/docker.sock"})
+	resp, body := mcpPost(t, srv.URL, map[string]string{"X-Daemon": "tcp://client:2375"}, initializeRequest)
+	id := resp.Header.Get(server.HeaderKeySessionID)
+	if resp.StatusCode != http.StatusOK || id == "" {
+		t.Fatalf("initialize: status %d, session %q: %s", resp.StatusCode, id, body)
+	}
+	if host := callWhoami(t, srv.URL, id); host != "tcp://client:2375" {
+		t.Errorf("call went to %q, want the session's daemon", host)
+	}
+}
+
+// An initialize request that carries a made-up session id still opens a new
+// session, so it must not skip the daemon config checks and end up on the
+// server's own daemon.
+func TestInitializeWithSessionIDNeedsDaemonConfig(t *testing.T) {
+	srv := mcpTestServer(t, &config.APIConfig{Host: "unix:///var/run/docker.sock"})
+	for _, id := range []string{"", "made-up", sessionIDPrefix + "00"} {
+		resp, body := mcpPost(t, srv.URL, map[string]string{server.HeaderKeySessionID: id}, initializeRequest)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "Missing API_BASE_URL header") {
+			t.Errorf("initialize with session id %q: status %d: %s", id, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get(server.HeaderKeySessionID); got != "" {
+			if host := callWhoami(t, srv.URL, got); !strings.HasPrefix(host, "status 404") {
+				t.Errorf("session %s opened without a daemon reached %q", got, host)
+			}
+		}
+	}
+}
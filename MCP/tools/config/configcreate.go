@@ -15,6 +15,7 @@ import (
 
 func ConfigcreateHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -36,15 +37,14 @@ func ConfigcreateHandler(cfg *config.APIConfig) func(ctx context.Context, reques
 			return mcp.NewToolResultErrorFromErr("Failed to encode request body", err), nil
 		}
 		url := fmt.Sprintf("%s/configs/create", cfg.BaseURL)
-		req, err := http.NewRequest("POST", url, bytes.NewBuffer(bodyBytes))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(bodyBytes))
 		req.Header.Set("Content-Type", "application/json")
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -83,7 +83,10 @@ func CreateConfigcreateTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    ConfigcreateHandler(cfg),
+		Definition:    tool,
+		Handler:       ConfigcreateHandler(cfg),
+		Toolset:       models.ToolsetSwarm,
+		Method:        "POST",
+		MinAPIVersion: "1.30",
 	}
 }
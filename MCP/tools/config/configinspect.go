@@ -14,6 +14,7 @@ import (
 
 func ConfiginspectHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -27,14 +28,13 @@ func ConfiginspectHandler(cfg *config.APIConfig) func(ctx context.Context, reque
 			return mcp.NewToolResultError("Invalid path parameter: id"), nil
 		}
 		url := fmt.Sprintf("%s/configs/%s", cfg.BaseURL, id)
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -71,7 +71,11 @@ func CreateConfiginspectTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    ConfiginspectHandler(cfg),
+		Definition:    tool,
+		Handler:       ConfiginspectHandler(cfg),
+		Toolset:       models.ToolsetSwarm,
+		Method:        "GET",
+		ReadOnly:      true,
+		MinAPIVersion: "1.30",
 	}
 }
@@ -15,6 +15,7 @@ import (
 
 func ConfiglistHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -28,14 +29,13 @@ func ConfiglistHandler(cfg *config.APIConfig) func(ctx context.Context, request
 			queryString = "?" + strings.Join(queryParams, "&")
 		}
 		url := fmt.Sprintf("%s/configs%s", cfg.BaseURL, queryString)
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -50,7 +50,7 @@ func ConfiglistHandler(cfg *config.APIConfig) func(ctx context.Context, request
 			return mcp.NewToolResultError(fmt.Sprintf("API error: %s", body)), nil
 		}
 		// Use properly typed response
-		var result []Config
+		var result []models.Config
 		if err := json.Unmarshal(body, &result); err != nil {
 			// Fallback to raw text if unmarshaling fails
 			return mcp.NewToolResultText(string(body)), nil
@@ -72,7 +72,12 @@ func CreateConfiglistTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    ConfiglistHandler(cfg),
+		Definition:    tool,
+		Handler:       ConfiglistHandler(cfg),
+		Toolset:       models.ToolsetSwarm,
+		Method:        "GET",
+		ReadOnly:      true,
+		MinAPIVersion: "1.30",
+		FanOut:        true,
 	}
 }
@@ -15,6 +15,7 @@ import (
 
 func ContainerarchiveinfoHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -36,14 +37,13 @@ func ContainerarchiveinfoHandler(cfg *config.APIConfig) func(ctx context.Context
 			queryString = "?" + strings.Join(queryParams, "&")
 		}
 		url := fmt.Sprintf("%s/containers/%s/archive%s", cfg.BaseURL, id, queryString)
-		req, err := http.NewRequest("HEAD", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -83,5 +83,8 @@ func CreateContainerarchiveinfoTool(cfg *config.APIConfig) models.Tool {
 	return models.Tool{
 		Definition: tool,
 		Handler:    ContainerarchiveinfoHandler(cfg),
+		Toolset:    models.ToolsetContainers,
+		Method:     "HEAD",
+		ReadOnly:   true,
 	}
 }
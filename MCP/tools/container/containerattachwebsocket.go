@@ -15,6 +15,7 @@ import (
 
 func ContainerattachwebsocketHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -51,14 +52,13 @@ func ContainerattachwebsocketHandler(cfg *config.APIConfig) func(ctx context.Con
 			queryString = "?" + strings.Join(queryParams, "&")
 		}
 		url := fmt.Sprintf("%s/containers/%s/attach/ws%s", cfg.BaseURL, id, queryString)
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -101,7 +101,11 @@ func CreateContainerattachwebsocketTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    ContainerattachwebsocketHandler(cfg),
+		Definition:  tool,
+		Handler:     ContainerattachwebsocketHandler(cfg),
+		Toolset:     models.ToolsetExec,
+		Method:      "GET",
+		LongRunning: true,
+		Streaming:   true,
 	}
 }
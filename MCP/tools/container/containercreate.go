@@ -16,6 +16,7 @@ import (
 
 func ContainercreateHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -45,15 +46,14 @@ func ContainercreateHandler(cfg *config.APIConfig) func(ctx context.Context, req
 			return mcp.NewToolResultErrorFromErr("Failed to encode request body", err), nil
 		}
 		url := fmt.Sprintf("%s/containers/create%s", cfg.BaseURL, queryString)
-		req, err := http.NewRequest("POST", url, bytes.NewBuffer(bodyBytes))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(bodyBytes))
 		req.Header.Set("Content-Type", "application/json")
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -119,5 +119,7 @@ func CreateContainercreateTool(cfg *config.APIConfig) models.Tool {
 	return models.Tool{
 		Definition: tool,
 		Handler:    ContainercreateHandler(cfg),
+		Toolset:    models.ToolsetContainers,
+		Method:     "POST",
 	}
 }
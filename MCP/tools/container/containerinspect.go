@@ -15,6 +15,7 @@ import (
 
 func ContainerinspectHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -36,14 +37,13 @@ func ContainerinspectHandler(cfg *config.APIConfig) func(ctx context.Context, re
 			queryString = "?" + strings.Join(queryParams, "&")
 		}
 		url := fmt.Sprintf("%s/containers/%s/json%s", cfg.BaseURL, id, queryString)
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -83,5 +83,8 @@ func CreateContainerinspectTool(cfg *config.APIConfig) models.Tool {
 	return models.Tool{
 		Definition: tool,
 		Handler:    ContainerinspectHandler(cfg),
+		Toolset:    models.ToolsetContainers,
+		Method:     "GET",
+		ReadOnly:   true,
 	}
 }
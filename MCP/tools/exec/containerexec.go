@@ -15,6 +15,7 @@ import (
 
 func ContainerexecHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -44,15 +45,14 @@ func ContainerexecHandler(cfg *config.APIConfig) func(ctx context.Context, reque
 			return mcp.NewToolResultErrorFromErr("Failed to encode request body", err), nil
 		}
 		url := fmt.Sprintf("%s/containers/%s/exec", cfg.BaseURL, id)
-		req, err := http.NewRequest("POST", url, bytes.NewBuffer(bodyBytes))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(bodyBytes))
 		req.Header.Set("Content-Type", "application/json")
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -100,5 +100,7 @@ func CreateContainerexecTool(cfg *config.APIConfig) models.Tool {
 	return models.Tool{
 		Definition: tool,
 		Handler:    ContainerexecHandler(cfg),
+		Toolset:    models.ToolsetExec,
+		Method:     "POST",
 	}
 }
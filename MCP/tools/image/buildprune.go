@@ -14,15 +14,15 @@ import (
 
 func BuildpruneHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		url := fmt.Sprintf("%s/build/prune", cfg.BaseURL)
-		req, err := http.NewRequest("POST", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -58,7 +58,12 @@ func CreateBuildpruneTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    BuildpruneHandler(cfg),
+		Definition:    tool,
+		Handler:       BuildpruneHandler(cfg),
+		Toolset:       models.ToolsetImages,
+		Method:        "POST",
+		Destructive:   true,
+		MinAPIVersion: "1.31",
+		LongRunning:   true,
 	}
 }
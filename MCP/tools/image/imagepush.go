@@ -15,6 +15,7 @@ import (
 
 func ImagepushHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -36,17 +37,16 @@ func ImagepushHandler(cfg *config.APIConfig) func(ctx context.Context, request m
 			queryString = "?" + strings.Join(queryParams, "&")
 		}
 		url := fmt.Sprintf("%s/images/%s/push%s", cfg.BaseURL, name, queryString)
-		req, err := http.NewRequest("POST", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 		if val, ok := args["X-Registry-Auth"]; ok {
 			req.Header.Set("X-Registry-Auth", fmt.Sprintf("%v", val))
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -85,7 +85,10 @@ func CreateImagepushTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    ImagepushHandler(cfg),
+		Definition:  tool,
+		Handler:     ImagepushHandler(cfg),
+		Toolset:     models.ToolsetImages,
+		Method:      "POST",
+		LongRunning: true,
 	}
 }
@@ -15,6 +15,7 @@ import (
 
 func NetworkpruneHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -28,14 +29,13 @@ func NetworkpruneHandler(cfg *config.APIConfig) func(ctx context.Context, reques
 			queryString = "?" + strings.Join(queryParams, "&")
 		}
 		url := fmt.Sprintf("%s/networks/prune%s", cfg.BaseURL, queryString)
-		req, err := http.NewRequest("POST", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -72,7 +72,12 @@ func CreateNetworkpruneTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    NetworkpruneHandler(cfg),
+		Definition:    tool,
+		Handler:       NetworkpruneHandler(cfg),
+		Toolset:       models.ToolsetNetworks,
+		Method:        "POST",
+		Destructive:   true,
+		MinAPIVersion: "1.25",
+		LongRunning:   true,
 	}
 }
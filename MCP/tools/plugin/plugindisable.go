@@ -14,6 +14,7 @@ import (
 
 func PlugindisableHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -27,14 +28,13 @@ func PlugindisableHandler(cfg *config.APIConfig) func(ctx context.Context, reque
 			return mcp.NewToolResultError("Invalid path parameter: name"), nil
 		}
 		url := fmt.Sprintf("%s/plugins/%s/disable", cfg.BaseURL, name)
-		req, err := http.NewRequest("POST", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -71,7 +71,10 @@ func CreatePlugindisableTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    PlugindisableHandler(cfg),
+		Definition:    tool,
+		Handler:       PlugindisableHandler(cfg),
+		Toolset:       models.ToolsetPlugins,
+		Method:        "POST",
+		MinAPIVersion: "1.25",
 	}
 }
@@ -16,6 +16,7 @@ import (
 
 func PluginpullHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		args, ok := request.Params.Arguments.(map[string]any)
 		if !ok {
 			return mcp.NewToolResultError("Invalid arguments object"), nil
@@ -48,18 +49,17 @@ func PluginpullHandler(cfg *config.APIConfig) func(ctx context.Context, request
 			return mcp.NewToolResultErrorFromErr("Failed to encode request body", err), nil
 		}
 		url := fmt.Sprintf("%s/plugins/pull%s", cfg.BaseURL, queryString)
-		req, err := http.NewRequest("POST", url, bytes.NewBuffer(bodyBytes))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(bodyBytes))
 		req.Header.Set("Content-Type", "application/json")
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 		if val, ok := args["X-Registry-Auth"]; ok {
 			req.Header.Set("X-Registry-Auth", fmt.Sprintf("%v", val))
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -99,7 +99,12 @@ func CreatePluginpullTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    PluginpullHandler(cfg),
+		Definition:    tool,
+		Handler:       PluginpullHandler(cfg),
+		Toolset:       models.ToolsetPlugins,
+		Method:        "POST",
+		MinAPIVersion: "1.25",
+		LongRunning:   true,
+		Streaming:     true,
 	}
 }
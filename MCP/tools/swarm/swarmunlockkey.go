@@ -14,15 +14,15 @@ import (
 
 func SwarmunlockkeyHandler(cfg *config.APIConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cfg := config.FromContext(ctx, cfg)
 		url := fmt.Sprintf("%s/swarm/unlockkey", cfg.BaseURL)
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Failed to create request", err), nil
 		}
-		// No authentication required for this endpoint
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := cfg.HTTPClient().Do(req)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("Request failed", err), nil
 		}
@@ -58,7 +58,10 @@ func CreateSwarmunlockkeyTool(cfg *config.APIConfig) models.Tool {
 	)
 
 	return models.Tool{
-		Definition: tool,
-		Handler:    SwarmunlockkeyHandler(cfg),
+		Definition:    tool,
+		Handler:       SwarmunlockkeyHandler(cfg),
+		Toolset:       models.ToolsetSwarm,
+		Method:        "GET",
+		MinAPIVersion: "1.25",
 	}
 }
@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker-engine-api/mcp-server/config"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fakeDaemon answers /_ping and /info on a unix socket, as the Engine does.
+func fakeDaemon(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	ping := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.30")
+		w.Write([]byte("OK"))
+	}
+	mux.HandleFunc("/_ping", ping)
+	mux.HandleFunc("/v1.30/_ping", ping)
+	mux.HandleFunc("/v1.30/info", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Name":"fake-daemon","Containers":3}`))
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return socket
+}
+
+func TestToolsReachUnixSocketDaemon(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "")
+	cfg := &config.APIConfig{BaseURL: "unix://" + fakeDaemon(t)}
+	if err := cfg.Resolve(); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	tests := []struct {
+		name    string
+		handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)
+		want    string
+	}{
+		{"ping", CreateSystempingTool(cfg).Handler, "OK"},
+		{"info", CreateSysteminfoTool(cfg).Handler, `"Name": "fake-daemon"`},
+	}
+	for _, tt := range tests {
+		result, err := tt.handler(context.Background(), mcp.CallToolRequest{})
+		if err != nil || result.IsError {
+			t.Fatalf("%s: result %+v, error %v", tt.name, result, err)
+		}
+		if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, tt.want) {
+			t.Errorf("%s: %q, want %q in it", tt.name, text, tt.want)
+		}
+	}
+}
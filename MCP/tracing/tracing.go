@@ -0,0 +1,197 @@
+// Package tracing records OpenTelemetry spans for tool calls and the Engine
+// API requests they make, continuing traces started by MCP clients.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/docker-engine-api/mcp-server/clientauth"
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/docker-engine-api/mcp-server/redact"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxAttributeLen bounds the tool arguments and error text stored on spans.
+const maxAttributeLen = 4096
+
+// headerEndpoint names daemons that clients chose in request headers.
+const headerEndpoint = "header"
+
+// tracer returns the tracer of the current provider. It is looked up on
+// every use rather than once, so a provider installed later, by Setup or a
+// test, takes effect.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/docker-engine-api/mcp-server")
+}
+
+// Options select where spans are exported.
+type Options struct {
+	Exporter     string    // "otlp", "stdout", "file", or "" to disable tracing
+	File         string    // Destination of the "file" exporter
+	OTLPEndpoint string    // OTLP/HTTP URL; OTEL_EXPORTER_OTLP_* variables apply when empty
+	Stdout       io.Writer // Destination of the "stdout" exporter
+	Version      string    // Reported as service.version
+}
+
+// Setup installs the global tracer provider and propagator for opts. The
+// returned function flushes pending spans; it is a no-op when tracing is off.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	var exporter sdktrace.SpanExporter
+	switch strings.ToLower(opts.Exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var otlpOpts []otlptracehttp.Option
+		if opts.OTLPEndpoint != "" {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, otlpOpts...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(opts.Stdout))
+	case "file":
+		if opts.File == "" {
+			return nil, fmt.Errorf("the file exporter needs a file")
+		}
+		var f *os.File
+		if f, err = os.OpenFile(opts.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
+			exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		}
+	default:
+		return nil, fmt.Errorf("unknown exporter %q, expected otlp, stdout or file", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", "docker-engine-mcp"),
+			attribute.String("service.version", opts.Version),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Handler continues the trace named in the traceparent and baggage headers
+// of incoming requests, so tool call spans join the client's trace.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Middleware records a span for every call of the tool, with its sanitized
+// arguments and whether it failed.
+func Middleware(tool models.Tool) models.Tool {
+	name := tool.Definition.Name
+	next := tool.Handler
+	tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, span := tracer().Start(ctx, "tools/call "+name, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		if !span.IsRecording() {
+			return next(ctx, request)
+		}
+		span.SetAttributes(
+			attribute.String("mcp.tool.name", name),
+			attribute.String("mcp.tool.arguments", redact.JSON(request.GetArguments(), maxAttributeLen)),
+		)
+		if id, ok := clientauth.FromContext(ctx); ok {
+			span.SetAttributes(attribute.String("enduser.id", id.Name))
+		}
+
+		result, err := next(ctx, request)
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.SetAttributes(attribute.String("mcp.tool.result", "error"))
+		case result != nil && result.IsError:
+			span.SetStatus(codes.Error, truncate(resultText(result)))
+			span.SetAttributes(attribute.String("mcp.tool.result", "error"))
+		default:
+			span.SetAttributes(attribute.String("mcp.tool.result", "success"))
+		}
+		return result, err
+	}
+	return tool
+}
+
+// Transport records a client span for every request sent through next to
+// the daemon named endpoint and passes the trace context on to it. It
+// matches config.TransportMiddleware.
+func Transport(endpoint string, next http.RoundTripper) http.RoundTripper {
+	if endpoint == "" {
+		endpoint = headerEndpoint
+	}
+	return &transport{endpoint: endpoint, next: next}
+}
+
+type transport struct {
+	endpoint string
+	next     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracer().Start(req.Context(), "Engine API "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.URL.Path),
+			attribute.String("docker.endpoint", t.endpoint),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+func resultText(result *mcp.CallToolResult) string {
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			return text.Text
+		}
+	}
+	return ""
+}
+
+func truncate(s string) string {
+	if len(s) > maxAttributeLen {
+		return s[:maxAttributeLen] + "..."
+	}
+	return s
+}
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker-engine-api/mcp-server/models"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const clientTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+// recordSpans installs a provider that keeps finished spans in memory.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return recorder
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+// A tool call continues the client's trace, and the daemon request it makes
+// is a child span whose context reaches the daemon.
+func TestToolCallAndDaemonRequestSpans(t *testing.T) {
+	recorder := recordSpans(t)
+	var daemonTraceparent string
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		daemonTraceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer daemon.Close()
+	client := &http.Client{Transport: Transport("prod", http.DefaultTransport)}
+
+	tool := Middleware(models.Tool{
+		Definition: mcp.NewTool("post_auth"),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			req, _ := http.NewRequestWithContext(ctx, "POST", daemon.URL+"/v1.30/auth", nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+			return mcp.NewToolResultError("API error: no such registry"), nil
+		},
+	})
+	mcpServer := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = map[string]any{"username": "ci", "password": "hunter2"}
+		tool.Handler(r.Context(), request)
+	}))
+	r := httptest.NewRequest("POST", "/mcp", nil)
+	r.Header.Set("traceparent", "00-"+clientTrace+"-00f067aa0ba902b7-01")
+	mcpServer.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans, want the daemon request and the tool call", len(spans))
+	}
+	request, call := spans[0], spans[1]
+	if call.Name() != "tools/call post_auth" || request.Name() != "Engine API POST" {
+		t.Fatalf("spans %q and %q", call.Name(), request.Name())
+	}
+	if got := call.SpanContext().TraceID().String(); got != clientTrace {
+		t.Errorf("tool call trace %s, want the client's %s", got, clientTrace)
+	}
+	if request.Parent().SpanID() != call.SpanContext().SpanID() {
+		t.Error("the daemon request is not a child of the tool call")
+	}
+	if !strings.Contains(daemonTraceparent, request.SpanContext().SpanID().String()) {
+		t.Errorf("daemon got traceparent %q, want the request span", daemonTraceparent)
+	}
+
+	if args := attr(call, "mcp.tool.arguments"); strings.Contains(args, "hunter2") || !strings.Contains(args, "ci") {
+		t.Errorf("arguments attribute %s, want the password masked", args)
+	}
+	if attr(call, "mcp.tool.result") != "error" || call.Status().Code != codes.Error {
+		t.Errorf("tool call result %q, status %v; want an error", attr(call, "mcp.tool.result"), call.Status())
+	}
+	if attr(request, "http.response.status_code") != "404" || attr(request, "docker.endpoint") != "prod" || attr(request, "url.path") != "/v1.30/auth" {
+		t.Errorf("request attributes %v", request.Attributes())
+	}
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(context.Background(), Options{Exporter: "file", File: file, Version: "test"})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	tool := Middleware(models.Tool{
+		Definition: mcp.NewTool("get_info"),
+		Handler: func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("{}"), nil
+		},
+	})
+	tool.Handler(context.Background(), mcp.CallToolRequest{})
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Name":"tools/call get_info"`) {
+		t.Errorf("file exporter wrote %s", data)
+	}
+
+	for _, opts := range []Options{{Exporter: "file"}, {Exporter: "zipkin"}} {
+		if _, err := Setup(context.Background(), opts); err == nil {
+			t.Errorf("Setup(%+v) succeeded, want an error", opts)
+		}
+	}
+}